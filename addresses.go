@@ -0,0 +1,39 @@
+package wsstat
+
+import (
+	"context"
+	"net/url"
+)
+
+// MeasureFunc runs one measurement with the given options appended to its own,
+// for example MeasureLatencyPingContext with its other arguments bound.
+type MeasureFunc func(ctx context.Context, opts ...Option) (Result, error)
+
+// AddressResult is the outcome of a measurement against one of the addresses a host resolves to.
+type AddressResult struct {
+	IP     string // Address the measurement connected to
+	Result Result // Result of the measurement, partial if Err is set
+	Err    error  // Error returned by the measurement, if any
+}
+
+// MeasureAllAddresses resolves the host of url with the resolver and address family set in
+// opts, and runs measure once against each of its A and AAAA records in turn, so that a faulty backend behind round-robin DNS stands out.
+// The returned error is only set if the host cannot be resolved; failures of single
+// measurements are reported in their AddressResult.
+func MeasureAllAddresses(ctx context.Context, url *url.URL, measure MeasureFunc, opts ...Option) ([]AddressResult, error) {
+	cfg := newConfig(opts...)
+	answer, err := cfg.resolve(ctx, url.Hostname())
+	if err != nil {
+		return nil, &PhaseError{Phase: PhaseDNS, Err: contextError(ctx, err)}
+	}
+
+	results := make([]AddressResult, 0, len(answer.Addrs))
+	for _, addr := range answer.Addrs {
+		result, err := measure(ctx, append(opts[:len(opts):len(opts)], WithDialAddress(addr.IP))...)
+		results = append(results, AddressResult{IP: addr.IP.String(), Result: result, Err: err})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return results, nil
+}
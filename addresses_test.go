@@ -0,0 +1,65 @@
+package wsstat
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRemoteAddr(t *testing.T) {
+	u, _ := url.Parse("ws://localhost:8080/echo")
+	result, err := MeasureLatencyPing(u, http.Header{}, WithDialAddress(net.ParseIP("127.0.0.1")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RemoteAddr != "127.0.0.1:8080" {
+		t.Errorf("Expected remote address 127.0.0.1:8080, got %q", result.RemoteAddr)
+	}
+	if len(result.IPs) == 0 {
+		t.Error("Expected resolved IPs")
+	}
+	found := false
+	for _, ip := range result.IPs {
+		found = found || ip == "127.0.0.1"
+	}
+	if !found {
+		t.Errorf("Expected 127.0.0.1 among the resolved IPs %v", result.IPs)
+	}
+}
+
+func TestMeasureAllAddresses(t *testing.T) {
+	u, _ := url.Parse("ws://localhost:8080/echo")
+	addrs, err := net.DefaultResolver.LookupHost(context.Background(), "localhost")
+	if err != nil {
+		t.Fatalf("Failed to resolve localhost: %v", err)
+	}
+
+	measure := func(ctx context.Context, opts ...Option) (Result, error) {
+		return MeasureLatencyPingContext(ctx, u, http.Header{}, opts...)
+	}
+	results, err := MeasureAllAddresses(context.Background(), u, measure)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != len(addrs) {
+		t.Fatalf("Expected %d results, got %d", len(addrs), len(results))
+	}
+	for _, r := range results {
+		host, _, err := net.SplitHostPort(r.Result.RemoteAddr)
+		if err != nil && r.Err == nil {
+			t.Errorf("Invalid remote address %q for %s", r.Result.RemoteAddr, r.IP)
+			continue
+		}
+		// The echo server may only listen on one of the loopback addresses
+		if r.Err == nil && !net.ParseIP(host).Equal(net.ParseIP(r.IP)) {
+			t.Errorf("Expected connection to %s, got %s", r.IP, r.Result.RemoteAddr)
+		}
+	}
+
+	invalid, _ := url.Parse("ws://host.invalid")
+	if _, err := MeasureAllAddresses(context.Background(), invalid, measure); ErrorPhase(err) != PhaseDNS {
+		t.Errorf("Expected DNS phase error, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package wsstat
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// certExpiryWarning is how long before its expiry a certificate is warned about.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// Minimum key sizes below which a certificate key is reported as weak.
+const (
+	minRSABits   = 2048
+	minECDSABits = 256
+)
+
+// oidSCTList identifies the certificate extension holding embedded signed certificate timestamps, see RFC 6962.
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// OCSP statuses of a CertificateReport.
+const (
+	OCSPNone    = "none"    // No OCSP response was stapled
+	OCSPGood    = "good"    // The stapled response reports the certificate as valid
+	OCSPRevoked = "revoked" // The stapled response reports the certificate as revoked
+	OCSPUnknown = "unknown" // The stapled response does not know the certificate
+	OCSPInvalid = "invalid" // The stapled response could not be parsed or verified
+)
+
+// CertificateReport is the result of verifying the certificates presented by the server.
+// It is computed independently of the TLS configuration, so it is also set when
+// InsecureSkipVerify is used.
+type CertificateReport struct {
+	Verified        bool      // Whether the chain verified against the roots
+	VerifyError     string    // Why the chain did not verify, if it did not
+	Roots           string    // Roots verified against, "system" or "custom" for tls.Config.RootCAs
+	Chain           []string  // Subjects of the verified chain, from the leaf to the root
+	HostnameMatch   bool      // Whether the leaf certificate is valid for the server name
+	EarliestExpiry  time.Time // Earliest NotAfter of the presented certificates
+	DaysUntilExpiry int       // Whole days until EarliestExpiry, rounded down so negative once expired
+	OCSPStatus      string    // Status of the stapled OCSP response, one of the OCSP constants
+	SCTs            int       // Number of signed certificate timestamps, from the TLS extension and the leaf
+	Warnings        []string  // Weak keys, SHA-1 signatures and upcoming expiry
+}
+
+// certificateReport returns the report of the certificates of the TLS connection dialed to url,
+// or nil if there is none.
+func (ws *WSStat) certificateReport(url *url.URL) *CertificateReport {
+	if ws.Result.TLSState == nil {
+		return nil
+	}
+	serverName := url.Hostname()
+	var roots *x509.CertPool
+	if ws.cfg.tlsConfig != nil {
+		roots = ws.cfg.tlsConfig.RootCAs
+		if ws.cfg.tlsConfig.ServerName != "" {
+			serverName = ws.cfg.tlsConfig.ServerName
+		}
+	}
+	return newCertificateReport(ws.Result.TLSState, serverName, roots, time.Now())
+}
+
+// newCertificateReport verifies the peer certificates of state for serverName, against the
+// given roots or the system roots if nil.
+func newCertificateReport(state *tls.ConnectionState, serverName string, roots *x509.CertPool, now time.Time) *CertificateReport {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	leaf := certs[0]
+	report := &CertificateReport{Roots: "system", OCSPStatus: OCSPNone}
+	if roots != nil {
+		report.Roots = "custom"
+	}
+
+	// Verify the chain, separately from the host name so both are reported
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: now})
+	if err != nil {
+		report.VerifyError = err.Error()
+	} else {
+		report.Verified = true
+		for _, cert := range chains[0] {
+			report.Chain = append(report.Chain, cert.Subject.String())
+		}
+	}
+	report.HostnameMatch = leaf.VerifyHostname(serverName) == nil
+
+	for _, cert := range certs {
+		if report.EarliestExpiry.IsZero() || cert.NotAfter.Before(report.EarliestExpiry) {
+			report.EarliestExpiry = cert.NotAfter
+		}
+		report.Warnings = append(report.Warnings, certificateWarnings(cert)...)
+	}
+	report.DaysUntilExpiry = int(math.Floor(report.EarliestExpiry.Sub(now).Hours() / 24))
+	if until := report.EarliestExpiry.Sub(now); until < certExpiryWarning {
+		if until < 0 {
+			report.Warnings = append(report.Warnings, "certificate expired "+days(-report.DaysUntilExpiry)+" ago")
+		} else {
+			report.Warnings = append(report.Warnings, "certificate expires in "+days(report.DaysUntilExpiry))
+		}
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		report.OCSPStatus = ocspStatus(state.OCSPResponse, leaf, certs, chains)
+	}
+	report.SCTs = len(state.SignedCertificateTimestamps) + embeddedSCTs(leaf)
+	return report
+}
+
+// days formats a number of days, such as "1 day" or "3 days".
+func days(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
+
+// certificateWarnings returns the weaknesses of a certificate's key and signature.
+func certificateWarnings(cert *x509.Certificate) []string {
+	var warnings []string
+	name := cert.Subject.CommonName
+	if name == "" {
+		name = cert.Subject.String()
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < minRSABits {
+			warnings = append(warnings, fmt.Sprintf("%s: weak %d-bit RSA key", name, bits))
+		}
+	case *ecdsa.PublicKey:
+		if bits := key.Curve.Params().BitSize; bits < minECDSABits {
+			warnings = append(warnings, fmt.Sprintf("%s: weak %d-bit ECDSA key", name, bits))
+		}
+	}
+	// The signature of a self-signed root is not relied upon
+	if cert.CheckSignatureFrom(cert) != nil {
+		switch cert.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1, x509.MD5WithRSA, x509.MD2WithRSA:
+			warnings = append(warnings, fmt.Sprintf("%s: weak %s signature", name, cert.SignatureAlgorithm))
+		}
+	}
+	return warnings
+}
+
+// ocspStatus returns the status of a stapled OCSP response for leaf. The issuer is taken from
+// the verified chain, or else from the presented certificates.
+func ocspStatus(raw []byte, leaf *x509.Certificate, certs []*x509.Certificate, chains [][]*x509.Certificate) string {
+	var issuer *x509.Certificate
+	switch {
+	case len(chains) > 0 && len(chains[0]) > 1:
+		issuer = chains[0][1]
+	case len(certs) > 1:
+		issuer = certs[1]
+	default:
+		return OCSPInvalid
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return OCSPInvalid
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return OCSPGood
+	case ocsp.Revoked:
+		return OCSPRevoked
+	default:
+		return OCSPUnknown
+	}
+}
+
+// embeddedSCTs returns the number of signed certificate timestamps embedded in a certificate.
+func embeddedSCTs(cert *x509.Certificate) int {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			continue
+		}
+		// The extension is an OCTET STRING holding a length-prefixed list of length-prefixed SCTs
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(list) < 2 {
+			return 0
+		}
+		list = list[2:]
+		n := 0
+		for len(list) >= 2 {
+			size := int(binary.BigEndian.Uint16(list))
+			if len(list) < 2+size {
+				break
+			}
+			list = list[2+size:]
+			n++
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+package wsstat
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relaytools/go-wsstat/internal/wstest"
+	"golang.org/x/crypto/ocsp"
+)
+
+// issueCertificate creates a certificate for template signed by parent, or self-signed if parent is nil.
+func issueCertificate(t *testing.T, template *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+// newTestKey returns an ECDSA key on the given curve.
+func newTestKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+// startStaplingServer starts a wss:// echo server presenting a leaf certificate issued by its own CA,
+// with a stapled OCSP response and a signed certificate timestamp. It returns the server and the CA pool.
+func startStaplingServer(t *testing.T) (*httptest.Server, *x509.CertPool) {
+	now := time.Now()
+	caKey := newTestKey(t, elliptic.P256())
+	ca := issueCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, caKey, nil, nil)
+	leafKey := newTestKey(t, elliptic.P256())
+	leaf := issueCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "relay.test"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(10 * 24 * time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, leafKey, ca, caKey)
+
+	staple, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   now.Add(-time.Hour),
+		NextUpdate:   now.Add(time.Hour),
+	}, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create OCSP response: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(wstest.EchoHandler))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate:                 [][]byte{leaf.Raw, ca.Raw},
+		PrivateKey:                  leafKey,
+		OCSPStaple:                  staple,
+		SignedCertificateTimestamps: [][]byte{[]byte("sct")},
+	}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return server, roots
+}
+
+func TestCertificateReport(t *testing.T) {
+	server, roots := startStaplingServer(t)
+	result, err := MeasureLatencyPingContext(context.Background(), wsURL(t, server, "/echo"), http.Header{},
+		WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report := result.CertificateReport
+	if report == nil {
+		t.Fatal("Expected a certificate report")
+	}
+	if !report.Verified || report.Roots != "custom" || len(report.Chain) != 2 || !report.HostnameMatch {
+		t.Errorf("Expected a verified chain matching the host name: %+v", report)
+	}
+	if report.DaysUntilExpiry < 9 || report.DaysUntilExpiry > 10 {
+		t.Errorf("Unexpected days until expiry: %d", report.DaysUntilExpiry)
+	}
+	if report.OCSPStatus != OCSPGood || report.SCTs != 1 {
+		t.Errorf("Unexpected OCSP status %s and %d SCTs", report.OCSPStatus, report.SCTs)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "expires in") {
+		t.Errorf("Expected an expiry warning, got %v", report.Warnings)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "OCSP staple: good") {
+		t.Errorf("Expected the report in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.CertificateReport == nil || decoded.CertificateReport.OCSPStatus != OCSPGood ||
+		!decoded.CertificateReport.EarliestExpiry.Equal(report.EarliestExpiry) {
+		t.Errorf("Unexpected decoded report: %+v", decoded.CertificateReport)
+	}
+}
+
+func TestCertificateReportUnverified(t *testing.T) {
+	server, _ := wstest.StartTLSEchoServer(t)
+	result, err := MeasureLatencyPingContext(context.Background(), wsURL(t, server, "/echo"), http.Header{},
+		WithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report := result.CertificateReport
+	if report == nil || report.Verified || report.VerifyError == "" || report.Roots != "system" {
+		t.Errorf("Expected the chain to not verify against the system roots: %+v", report)
+	}
+	if report != nil && report.OCSPStatus != OCSPNone {
+		t.Errorf("Expected no stapled OCSP response, got %s", report.OCSPStatus)
+	}
+}
+
+func TestCertificateWarnings(t *testing.T) {
+	key := newTestKey(t, elliptic.P224())
+	cert := issueCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "weak.test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, key, nil, nil)
+	warnings := certificateWarnings(cert)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "224-bit ECDSA") {
+		t.Errorf("Expected a weak key warning, got %v", warnings)
+	}
+}
+
+func TestCertificateReportExpired(t *testing.T) {
+	notAfter := time.Now()
+	cert := issueCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expired.test"},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}, newTestKey(t, elliptic.P256()), nil, nil)
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	// Expired for less than a day still counts as expired
+	report := newCertificateReport(state, "expired.test", nil, notAfter.Add(2*time.Hour))
+	if report.DaysUntilExpiry != -1 {
+		t.Errorf("Expected -1 days until expiry, got %d", report.DaysUntilExpiry)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "expired 1 day ago") {
+		t.Errorf("Expected an expired warning, got %v", report.Warnings)
+	}
+	report = newCertificateReport(state, "expired.test", nil, notAfter.Add(25*time.Hour))
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "expired 2 days ago") {
+		t.Errorf("Expected an expired warning, got %v", report.Warnings)
+	}
+	if report = newCertificateReport(state, "expired.test", nil, notAfter.Add(-2*time.Hour)); report.DaysUntilExpiry != 0 {
+		t.Errorf("Expected 0 days until expiry, got %d", report.DaysUntilExpiry)
+	}
+}
@@ -0,0 +1,154 @@
+package wsstat
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// ClientAuth reports the client certificate exchange of a TLS handshake.
+type ClientAuth struct {
+	Requested     bool     // Whether the server requested a client certificate
+	AcceptableCAs []string // Distinguished names of the CAs the server accepts, if it advertised any
+	Sent          bool     // Whether a client certificate was sent
+	Subject       string   // Subject of the sent certificate
+}
+
+// LoadClientCertificate reads a client certificate chain and its key from PEM files.
+// If keyFile is empty, the key is read from certFile.
+func LoadClientCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// LoadPKCS12 reads a client certificate chain and its key from a PKCS#12 (.p12 or .pfx) file.
+// Only the legacy 3DES and RC2 encryption is supported; files written with AES, the default of
+// OpenSSL 3, must be exported with -legacy.
+func LoadPKCS12(path, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS#12 file: %w", err)
+	}
+
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "PRIVATE KEY":
+			if key, err = parsePrivateKey(block.Bytes); err != nil {
+				return tls.Certificate{}, err
+			}
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if key == nil {
+		return tls.Certificate{}, errors.New("no private key found in PKCS#12 file")
+	}
+
+	// The bags are in no particular order, so the leaf is the certificate of the key
+	var chain tls.Certificate
+	chain.PrivateKey = key
+	for _, cert := range certs {
+		if isKeyOf(cert, key) && chain.Leaf == nil {
+			chain.Leaf = cert
+			chain.Certificate = append([][]byte{cert.Raw}, chain.Certificate...)
+		} else {
+			chain.Certificate = append(chain.Certificate, cert.Raw)
+		}
+	}
+	if chain.Leaf == nil {
+		return tls.Certificate{}, errors.New("no certificate for the private key found in PKCS#12 file")
+	}
+	return chain, nil
+}
+
+// parsePrivateKey parses a private key as converted by pkcs12.ToPEM: PKCS#1 for RSA keys
+// and SEC 1 for ECDSA keys, or PKCS#8.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("failed to parse private key in PKCS#12 file")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// isKeyOf reports whether key is the private key of cert.
+func isKeyOf(cert *x509.Certificate, key crypto.Signer) bool {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+// clientCertificateHook returns a GetClientCertificate callback for tlsConfig that records the
+// exchange in auth. It selects the certificate as crypto/tls does, or with the callback
+// already set.
+func clientCertificateHook(tlsConfig *tls.Config, auth *ClientAuth) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	getCertificate := tlsConfig.GetClientCertificate
+	certs := tlsConfig.Certificates
+	return func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		auth.Requested = true
+		for _, raw := range info.AcceptableCAs {
+			auth.AcceptableCAs = append(auth.AcceptableCAs, distinguishedName(raw))
+		}
+
+		cert := &tls.Certificate{} // Sending no certificate
+		if getCertificate != nil {
+			var err error
+			if cert, err = getCertificate(info); err != nil {
+				return nil, err
+			}
+		} else {
+			for i := range certs {
+				if info.SupportsCertificate(&certs[i]) == nil {
+					cert = &certs[i]
+					break
+				}
+			}
+		}
+		if cert != nil && len(cert.Certificate) > 0 {
+			auth.Sent = true
+			if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+				auth.Subject = leaf.Subject.String()
+			}
+		}
+		return cert, nil
+	}
+}
+
+// distinguishedName returns the string form of a DER-encoded distinguished name.
+func distinguishedName(der []byte) string {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdns); err != nil || len(rest) > 0 {
+		return fmt.Sprintf("%x", der)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name.String()
+}
@@ -0,0 +1,91 @@
+package wsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+// startMTLSEchoServer starts a wss:// echo server requiring a client certificate issued by
+// the certificate of client, and returns the server and a TLS configuration trusting it.
+func startMTLSEchoServer(t *testing.T, client tls.Certificate) (*httptest.Server, *tls.Config) {
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(client.Leaf)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(wstest.EchoHandler))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // Rejected handshakes are expected
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func TestLoadPKCS12(t *testing.T) {
+	if _, err := LoadPKCS12("testdata/client.p12", "wrong"); err == nil {
+		t.Error("Expected an error with the wrong password")
+	}
+	cert, err := LoadPKCS12("testdata/client.p12", "secret")
+	if err != nil {
+		t.Fatalf("Failed to load PKCS#12 file: %v", err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "wsstat test client" || len(cert.Certificate) != 1 {
+		t.Errorf("Unexpected certificate: %+v", cert.Leaf)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert, err := LoadPKCS12("testdata/client.p12", "secret")
+	if err != nil {
+		t.Fatalf("Failed to load PKCS#12 file: %v", err)
+	}
+	server, tlsConfig := startMTLSEchoServer(t, cert)
+	u := wsURL(t, server, "/echo")
+
+	// Without a certificate the server rejects the connection, after the TLS 1.3 handshake
+	result, err := MeasureLatencyPingContext(context.Background(), u, http.Header{}, WithTLSConfig(tlsConfig))
+	if err == nil {
+		t.Fatal("Expected an error without a client certificate")
+	}
+	auth := result.ClientAuth
+	if auth == nil || !auth.Requested || auth.Sent {
+		t.Fatalf("Expected a requested but unsent certificate: %+v", auth)
+	}
+	if len(auth.AcceptableCAs) != 1 || auth.AcceptableCAs[0] != "CN=wsstat test client" {
+		t.Errorf("Unexpected acceptable CAs: %v", auth.AcceptableCAs)
+	}
+
+	result, err = MeasureLatencyPingContext(context.Background(), u, http.Header{},
+		WithTLSConfig(tlsConfig), WithClientCertificate(cert))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if auth := result.ClientAuth; auth == nil || !auth.Sent || auth.Subject != "CN=wsstat test client" {
+		t.Errorf("Expected the certificate to be sent: %+v", auth)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "Sent: CN=wsstat test client") {
+		t.Errorf("Expected the client certificate in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.ClientAuth == nil || !decoded.ClientAuth.Sent || len(decoded.ClientAuth.AcceptableCAs) != 1 {
+		t.Errorf("Unexpected decoded client auth: %+v", decoded.ClientAuth)
+	}
+}
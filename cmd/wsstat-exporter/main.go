@@ -0,0 +1,85 @@
+// Command wsstat-exporter probes WebSocket targets and exposes the results as Prometheus metrics.
+//
+// Usage:
+//
+//	wsstat-exporter [-listen :9469] [-interval 30s] [-timeout 10s] [-target URL]...
+//
+// Metrics of the targets given with -target are served on /metrics, and any target
+// can be probed on request with /probe?target=URL.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relaytools/go-wsstat/exporter"
+)
+
+// targetFlags collects repeated -target flags.
+type targetFlags []exporter.Target
+
+func (t *targetFlags) String() string {
+	names := make([]string, len(*t))
+	for i, target := range *t {
+		names[i] = target.URL.String()
+	}
+	return strings.Join(names, ",")
+}
+
+func (t *targetFlags) Set(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("target scheme must be ws or wss, got %q", u.Scheme)
+	}
+	*t = append(*t, exporter.Target{URL: u})
+	return nil
+}
+
+func main() {
+	var targets targetFlags
+	listen := flag.String("listen", ":9469", "address to serve metrics on")
+	interval := flag.Duration("interval", 30*time.Second, "pause between probes of a target")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of a single probe")
+	message := flag.String("message", "", "text message to send to the targets, a ping is sent if empty")
+	flag.Var(&targets, "target", "ws:// or wss:// URL to probe continuously (repeatable)")
+	flag.Parse()
+
+	for i := range targets {
+		targets[i].Message = *message
+	}
+	exp := exporter.New(exporter.Config{
+		Targets:  targets,
+		Interval: *interval,
+		Timeout:  *timeout,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go exp.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp.Handler())
+	mux.Handle("/probe", exp.ProbeHandler())
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	log.Printf("Serving metrics on %s", *listen)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
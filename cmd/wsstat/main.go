@@ -0,0 +1,672 @@
+// Command wsstat measures the latency of a WebSocket connection, phase by phase.
+//
+// Usage:
+//
+//	wsstat [flags] URL
+//
+// The exit code identifies the phase in which the measurement failed, see exitCodes.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat"
+)
+
+// Exit codes of the command.
+const (
+	exitOK    = 0
+	exitError = 1 // Failure not attributed to a phase
+	exitUsage = 2
+)
+
+// exitCodes maps the phase in which a measurement failed to the exit code of the command.
+var exitCodes = map[wsstat.Phase]int{
+	wsstat.PhaseDNS:       3,
+	wsstat.PhaseTCP:       4,
+	wsstat.PhaseTLS:       5,
+	wsstat.PhaseWSUpgrade: 6,
+	wsstat.PhaseWrite:     7,
+	wsstat.PhaseRead:      8,
+	wsstat.PhaseClose:     9,
+	wsstat.PhaseProxy:     10,
+}
+
+// headerFlags collects repeated -H flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header must be in the form \"Name: value\", got %q", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(val))
+	return nil
+}
+
+// listFlags collects repeated or comma-separated flag values.
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// options holds the parsed command-line flags.
+type options struct {
+	url          *url.URL
+	text         string
+	json         string
+	ping         bool
+	headers      http.Header
+	subprotocols []string
+	compression  bool
+	compareComp  bool
+	insecure     bool
+	caFile       string
+	certFile     string
+	keyFile      string
+	certPassword string
+	timeout      time.Duration
+	count        int
+	interval     time.Duration
+	output       string
+	allAddresses bool
+	ipv4         bool
+	ipv6         bool
+	happyEyes    bool
+	resolver     wsstat.Resolver
+	proxy        *url.URL
+	unixSocket   string
+	resumption   bool
+	matcher      wsstat.Matcher
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns its exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseFlags(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	wsOpts := []wsstat.Option{wsstat.WithSubprotocols(opts.subprotocols...)}
+	if opts.compression {
+		wsOpts = append(wsOpts, wsstat.WithCompression())
+	}
+	switch {
+	case opts.ipv4:
+		wsOpts = append(wsOpts, wsstat.WithNetwork("tcp4"))
+	case opts.ipv6:
+		wsOpts = append(wsOpts, wsstat.WithNetwork("tcp6"))
+	case opts.happyEyes:
+		wsOpts = append(wsOpts, wsstat.WithHappyEyeballs(0))
+	}
+	if opts.resolver != nil {
+		wsOpts = append(wsOpts, wsstat.WithResolver(opts.resolver))
+	}
+	if opts.proxy != nil {
+		wsOpts = append(wsOpts, wsstat.WithProxy(opts.proxy))
+	}
+	if opts.unixSocket != "" {
+		wsOpts = append(wsOpts, wsstat.WithUnixSocket(opts.unixSocket))
+	}
+	if opts.matcher != nil {
+		wsOpts = append(wsOpts, wsstat.WithMatcher(opts.matcher))
+	}
+	tlsConfig, err := loadTLSConfig(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if tlsConfig != nil {
+		wsOpts = append(wsOpts, wsstat.WithTLSConfig(tlsConfig))
+	}
+
+	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	if opts.allAddresses {
+		return runAllAddresses(ctx, opts, wsOpts, stdout, stderr)
+	}
+	if opts.resumption {
+		return runResumption(ctx, opts, wsOpts, stdout, stderr)
+	}
+	if opts.compareComp {
+		return runCompression(ctx, opts, wsOpts, stdout, stderr)
+	}
+
+	result, response, err := measure(ctx, opts, wsOpts)
+	if werr := writeResult(stdout, opts.output, result, response); werr != nil {
+		fmt.Fprintln(stderr, werr)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wsstat: %v\n", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// runAllAddresses measures each address the host resolves to, and returns the exit code
+// of the first failed measurement.
+func runAllAddresses(ctx context.Context, opts *options, wsOpts []wsstat.Option, stdout, stderr io.Writer) int {
+	var responses [][]byte
+	// The addresses are resolved with the resolver and address family of the flags, which
+	// MeasureAllAddresses passes on to each measurement along with the address
+	results, err := wsstat.MeasureAllAddresses(ctx, opts.url, func(ctx context.Context, wsOpts ...wsstat.Option) (wsstat.Result, error) {
+		result, response, err := measure(ctx, opts, wsOpts)
+		responses = append(responses, response)
+		return result, err
+	}, wsOpts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "wsstat: %v\n", err)
+		return exitCode(err)
+	}
+	if werr := writeAddressResults(stdout, opts.output, results, responses); werr != nil {
+		fmt.Fprintln(stderr, werr)
+		return exitError
+	}
+
+	code := exitOK
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(stderr, "wsstat: %s: %v\n", r.IP, r.Err)
+			if code == exitOK {
+				code = exitCode(r.Err)
+			}
+		}
+	}
+	return code
+}
+
+// runResumption measures a full TLS handshake and a resumed one, and reports the saving.
+func runResumption(ctx context.Context, opts *options, wsOpts []wsstat.Option, stdout, stderr io.Writer) int {
+	r, err := wsstat.MeasureResumption(ctx, opts.url, opts.headers, wsOpts...)
+	var werr error
+	switch opts.output {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		werr = enc.Encode(r)
+	case "csv":
+		werr = writeCSV(stdout, r.Initial, r.Resumed)
+	default:
+		fmt.Fprintf(stdout, "=== Full handshake ===\n%+v\n", r.Initial)
+		fmt.Fprintf(stdout, "=== Resumed handshake ===\n%+v\n", r.Resumed)
+		_, werr = fmt.Fprintf(stdout, "Session resumed: %t\nTLS handshake saving: %s ms\n", r.DidResume, ms(r.Saving))
+	}
+	if werr != nil {
+		fmt.Fprintln(stderr, werr)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wsstat: %v\n", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// runCompression sends the message -n times over a connection without compression and over one
+// with compression, and reports the bytes on the wire and round-trip times of both.
+func runCompression(ctx context.Context, opts *options, wsOpts []wsstat.Option, stdout, stderr io.Writer) int {
+	payload := []byte(opts.text)
+	if opts.json != "" {
+		payload = []byte(opts.json)
+	}
+	payloads := make([][]byte, opts.count)
+	for i := range payloads {
+		payloads[i] = payload
+	}
+	r, err := wsstat.MeasureCompression(ctx, opts.url, payloads, opts.headers, wsOpts...)
+	var werr error
+	switch opts.output {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		werr = enc.Encode(r)
+	case "csv":
+		werr = writeCSV(stdout, r.Plain.Result, r.Compressed.Result)
+	default:
+		fmt.Fprintf(stdout, "=== Without compression ===\n%+v\n", r.Plain.Result)
+		fmt.Fprintf(stdout, "=== With compression ===\n%+v\n", r.Compressed.Result)
+		fmt.Fprintf(stdout, "Compression negotiated: %t\n", r.Negotiated)
+		fmt.Fprintf(stdout, "Payload bytes:          %d\n", r.Plain.PayloadBytes)
+		fmt.Fprintf(stdout, "Wire bytes:             %d without, %d with compression (ratio %.2f)\n",
+			r.Plain.WireBytes, r.Compressed.WireBytes, r.Ratio)
+		_, werr = fmt.Fprintf(stdout, "Mean round trip change: %s ms\n", ms(r.LatencyDifference))
+	}
+	if werr != nil {
+		fmt.Fprintln(stderr, werr)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wsstat: %v\n", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// exitCode returns the exit code for a failed measurement.
+func exitCode(err error) int {
+	if code, ok := exitCodes[wsstat.ErrorPhase(err)]; ok {
+		return code
+	}
+	return exitError
+}
+
+// parseFlags parses and validates the command-line arguments.
+func parseFlags(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{headers: http.Header{}}
+	var subprotocols listFlags
+	var resolver, proxy, match, matchJSON string
+
+	fs := flag.NewFlagSet("wsstat", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: wsstat [flags] URL\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.text, "text", "Hello, WebSocket!", "text message to send")
+	fs.StringVar(&opts.json, "json", "", "JSON message to send instead of the text message")
+	fs.BoolVar(&opts.ping, "ping", false, "send a ping instead of a message")
+	fs.Var(headerFlags(opts.headers), "H", "header to send with the handshake, \"Name: value\" (repeatable)")
+	fs.Var(&subprotocols, "subprotocol", "subprotocol to offer (repeatable or comma-separated)")
+	fs.BoolVar(&opts.compression, "compress", false, "offer permessage-deflate compression")
+	fs.BoolVar(&opts.compareComp, "compare-compression", false, "send the message -n times without and with compression, and compare the bytes on the wire")
+	fs.BoolVar(&opts.insecure, "insecure", false, "skip TLS certificate verification")
+	fs.StringVar(&opts.caFile, "cacert", "", "PEM file of CA certificates to verify the server with")
+	fs.StringVar(&opts.certFile, "cert", "", "PEM or PKCS#12 (.p12, .pfx) file of the client certificate")
+	fs.StringVar(&opts.keyFile, "key", "", "PEM file of the client certificate key, if not in the certificate file")
+	fs.StringVar(&opts.certPassword, "cert-password", "", "password of the PKCS#12 client certificate file")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout for the whole measurement, 0 for none")
+	fs.IntVar(&opts.count, "n", 1, "number of round trips to measure over the connection")
+	fs.DurationVar(&opts.interval, "interval", time.Second, "pause between round trips when -n is above 1")
+	fs.StringVar(&opts.output, "o", "pretty", "output format: pretty, json or csv")
+	fs.BoolVar(&opts.allAddresses, "all-ips", false, "measure each address the host resolves to in turn")
+	fs.BoolVar(&opts.ipv4, "4", false, "connect over IPv4 only")
+	fs.BoolVar(&opts.ipv6, "6", false, "connect over IPv6 only")
+	fs.BoolVar(&opts.happyEyes, "happy-eyeballs", false, "race IPv6 and IPv4 connection attempts and report the outcome")
+	fs.BoolVar(&opts.resumption, "resume", false, "connect twice to measure TLS session resumption, pinging each time")
+	fs.StringVar(&opts.unixSocket, "unix", "", "connect to this Unix domain socket instead of the host of the URL")
+	fs.StringVar(&proxy, "proxy", "", "proxy URL: http://, https://, socks5:// or socks5h://, with optional user:password@")
+	fs.StringVar(&match, "match", "", "regular expression identifying the response, skipping other messages")
+	fs.StringVar(&matchJSON, "match-json", "", "path=value identifying JSON responses, such as id=1 or 0=EOSE, skipping other messages")
+	fs.StringVar(&resolver, "resolver", "", "DNS resolver to use instead of the system's: udp://, tcp:// or tls:// host[:port], or an https:// DoH URL")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	opts.subprotocols = subprotocols
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, errors.New("exactly one URL is required")
+	}
+	u, err := url.Parse(fs.Arg(0))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("URL scheme must be ws or wss, got %q", u.Scheme)
+	}
+	opts.url = u
+
+	if resolver != "" {
+		if opts.resolver, err = parseResolver(resolver); err != nil {
+			return nil, err
+		}
+	}
+	if proxy != "" {
+		if opts.proxy, err = url.Parse(proxy); err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		switch opts.proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("proxy scheme must be http, https, socks5 or socks5h, got %q", opts.proxy.Scheme)
+		}
+	}
+
+	if opts.matcher, err = parseMatcher(match, matchJSON); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.count < 1:
+		return nil, errors.New("-n must be at least 1")
+	case opts.ping && opts.json != "":
+		return nil, errors.New("-ping and -json are mutually exclusive")
+	case opts.json != "" && !json.Valid([]byte(opts.json)):
+		return nil, errors.New("-json is not valid JSON")
+	case opts.keyFile != "" && opts.certFile == "":
+		return nil, errors.New("-key requires -cert")
+	case opts.ipv4 && opts.ipv6:
+		return nil, errors.New("-4 and -6 are mutually exclusive")
+	case (opts.ipv4 || opts.ipv6) && opts.happyEyes:
+		return nil, errors.New("-happy-eyeballs needs both address families, it cannot be used with -4 or -6")
+	case opts.unixSocket != "" && (opts.proxy != nil || opts.allAddresses):
+		return nil, errors.New("-unix cannot be used with -proxy or -all-ips")
+	case opts.resumption && (opts.allAddresses || opts.count > 1):
+		return nil, errors.New("-resume cannot be used with -all-ips or -n")
+	case opts.resumption && opts.url.Scheme != "wss":
+		return nil, errors.New("-resume requires a wss:// URL")
+	case opts.compareComp && (opts.ping || opts.allAddresses || opts.resumption):
+		return nil, errors.New("-compare-compression cannot be used with -ping, -all-ips or -resume")
+	}
+	switch opts.output {
+	case "pretty", "json", "csv":
+	default:
+		return nil, fmt.Errorf("unknown output format %q", opts.output)
+	}
+	return opts, nil
+}
+
+// parseMatcher returns the matcher described by the -match or -match-json flag, or nil if neither is set.
+// The value of -match-json is decoded as JSON if it is valid JSON, and taken as a string otherwise.
+func parseMatcher(match, matchJSON string) (wsstat.Matcher, error) {
+	switch {
+	case match != "" && matchJSON != "":
+		return nil, errors.New("-match and -match-json are mutually exclusive")
+	case match != "":
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match expression: %v", err)
+		}
+		return wsstat.MatchRegexp(re), nil
+	case matchJSON != "":
+		path, raw, ok := strings.Cut(matchJSON, "=")
+		if !ok {
+			return nil, fmt.Errorf("-match-json must be in the form path=value, got %q", matchJSON)
+		}
+		var value any = raw
+		if json.Valid([]byte(raw)) {
+			json.Unmarshal([]byte(raw), &value)
+		}
+		return wsstat.MatchJSONPath(path, value), nil
+	}
+	return nil, nil
+}
+
+// parseResolver returns the resolver described by a -resolver flag.
+func parseResolver(s string) (wsstat.Resolver, error) {
+	scheme, addr, ok := strings.Cut(s, "://")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("resolver must be in the form scheme://address, got %q", s)
+	}
+	switch scheme {
+	case "udp", "tcp":
+		return wsstat.NewDNSResolver(scheme, addr), nil
+	case "tls":
+		return wsstat.NewDoTResolver(addr, nil), nil
+	case "https":
+		return wsstat.NewDoHResolver(s, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown resolver scheme %q", scheme)
+	}
+}
+
+// loadTLSConfig builds the TLS configuration from the flags, or returns nil for the default configuration.
+func loadTLSConfig(opts *options) (*tls.Config, error) {
+	if !opts.insecure && opts.caFile == "" && opts.certFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.insecure}
+	if opts.caFile != "" {
+		pem, err := os.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.caFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if opts.certFile != "" {
+		var cert tls.Certificate
+		var err error
+		switch strings.ToLower(filepath.Ext(opts.certFile)) {
+		case ".p12", ".pfx":
+			cert, err = wsstat.LoadPKCS12(opts.certFile, opts.certPassword)
+		default:
+			cert, err = wsstat.LoadClientCertificate(opts.certFile, opts.keyFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// measure runs the measurement selected by the flags and returns the result and the response, if any.
+func measure(ctx context.Context, opts *options, wsOpts []wsstat.Option) (wsstat.Result, []byte, error) {
+	if opts.count > 1 {
+		sampler := wsstat.Sampler{
+			Count:       opts.count,
+			Interval:    opts.interval,
+			MessageType: websocket.TextMessage,
+			Payload:     []byte(opts.text),
+		}
+		if opts.ping {
+			sampler.MessageType = websocket.PingMessage
+		} else if opts.json != "" {
+			sampler.Payload = []byte(opts.json)
+		}
+		result, err := wsstat.MeasureLatencyNContext(ctx, opts.url, sampler, opts.headers, wsOpts...)
+		return result, nil, err
+	}
+
+	switch {
+	case opts.ping:
+		result, err := wsstat.MeasureLatencyPingContext(ctx, opts.url, opts.headers, wsOpts...)
+		return result, nil, err
+	case opts.json != "":
+		var msg interface{}
+		if err := json.Unmarshal([]byte(opts.json), &msg); err != nil {
+			return wsstat.Result{}, nil, err
+		}
+		result, response, err := wsstat.MeasureLatencyJSONContext(ctx, opts.url, msg, opts.headers, wsOpts...)
+		if err != nil || response == nil {
+			return result, nil, err
+		}
+		p, err := json.Marshal(response)
+		return result, p, err
+	default:
+		return wsstat.MeasureLatencyContext(ctx, opts.url, opts.text, opts.headers, wsOpts...)
+	}
+}
+
+// writeResult writes the result in the given output format.
+func writeResult(w io.Writer, format string, result wsstat.Result, response []byte) error {
+	switch format {
+	case "json":
+		out := struct {
+			Result   wsstat.Result `json:"result"`
+			Response string        `json:"response,omitempty"`
+		}{result, string(response)}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "csv":
+		return writeCSV(w, result)
+	default:
+		if response != nil {
+			fmt.Fprintf(w, "Response: %s\n\n", response)
+		}
+		_, err := fmt.Fprintf(w, "%+v\n", result)
+		return err
+	}
+}
+
+// writeAddressResults writes the results of measuring each resolved address in the given output format.
+func writeAddressResults(w io.Writer, format string, results []wsstat.AddressResult, responses [][]byte) error {
+	switch format {
+	case "json":
+		type addressJSON struct {
+			IP       string        `json:"ip"`
+			Result   wsstat.Result `json:"result"`
+			Response string        `json:"response,omitempty"`
+			Error    string        `json:"error,omitempty"`
+		}
+		out := make([]addressJSON, len(results))
+		for i, r := range results {
+			out[i] = addressJSON{IP: r.IP, Result: r.Result, Response: string(responses[i])}
+			if r.Err != nil {
+				out[i].Error = r.Err.Error()
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "csv":
+		rs := make([]wsstat.Result, len(results))
+		for i, r := range results {
+			rs[i] = r.Result
+		}
+		return writeCSV(w, rs...)
+	default:
+		for i, r := range results {
+			fmt.Fprintf(w, "=== %s ===\n", r.IP)
+			if r.Err != nil {
+				fmt.Fprintf(w, "Error: %v\n", r.Err)
+			}
+			if err := writeResult(w, format, r.Result, responses[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeCSV writes a header row and a row per result with its phase durations in milliseconds.
+func writeCSV(w io.Writer, results ...wsstat.Result) error {
+	// Results differ in their columns, such as only some having round-trip statistics,
+	// so the header holds the columns of all results and rows leave the missing ones empty
+	rows := make([]map[string]string, len(results))
+	var header []string
+	for i, result := range results {
+		rows[i] = map[string]string{}
+		for _, c := range csvColumns(result) {
+			if !slices.Contains(header, c.name) {
+				header = append(header, c.name)
+			}
+			rows[i][c.name] = c.value
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, values := range rows {
+		row := make([]string, len(header))
+		for j, name := range header {
+			row[j] = values[name]
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvColumn is a named value of a CSV row.
+type csvColumn struct {
+	name  string
+	value string
+}
+
+// csvColumns returns the CSV columns of a result.
+func csvColumns(result wsstat.Result) []csvColumn {
+	failedPhase := ""
+	if result.FailedPhase != wsstat.PhaseNone {
+		failedPhase = result.FailedPhase.String()
+	}
+	columns := []csvColumn{
+		{"url", result.URL.String()},
+		{"remote_addr", result.RemoteAddr},
+		{"failed_phase", failedPhase},
+		{"dns_lookup_ms", phaseMs(result, wsstat.PhaseDNS, result.DNSLookup)},
+		{"tcp_connection_ms", phaseMs(result, wsstat.PhaseTCP, result.TCPConnection)},
+		{"proxy_connect_ms", ms(result.ProxyConnect)},
+		{"tls_handshake_ms", ms(result.TLSHandshake)},
+		{"ws_handshake_ms", ms(result.WSHandshake)},
+		{"message_round_trip_ms", ms(result.MessageRoundTrip)},
+		{"connection_close_ms", ms(result.ConnectionClose)},
+		{"total_time_ms", ms(result.TotalTime)},
+		{"tls_handshake_bytes", wireBytes(result.Wire.TLS)},
+		{"ws_upgrade_bytes", wireBytes(result.Wire.WSUpgrade)},
+		{"message_bytes", wireBytes(result.Wire.Messages)},
+	}
+	if result.Stats != nil {
+		columns = append(columns, []csvColumn{
+			{"rtt_min_ms", ms(result.Stats.Min)},
+			{"rtt_mean_ms", ms(result.Stats.Mean)},
+			{"rtt_p50_ms", ms(result.Stats.P50)},
+			{"rtt_p90_ms", ms(result.Stats.P90)},
+			{"rtt_p99_ms", ms(result.Stats.P99)},
+			{"rtt_max_ms", ms(result.Stats.Max)},
+			{"rtt_stddev_ms", ms(result.Stats.StdDev)},
+			{"rtt_jitter_ms", ms(result.Stats.Jitter)},
+		}...)
+	}
+	return columns
+}
+
+// wireBytes formats the bytes written and read during a phase as their sum.
+func wireBytes(c wsstat.ByteCount) string {
+	return strconv.FormatInt(c.Written+c.Read, 10)
+}
+
+// phaseMs formats the duration of a phase as fractional milliseconds, or as n/a if the phase
+// does not apply to the transport of the result.
+func phaseMs(result wsstat.Result, phase wsstat.Phase, d time.Duration) string {
+	if !result.Applicable(phase) {
+		return "n/a"
+	}
+	return ms(d)
+}
+
+// ms formats a duration as fractional milliseconds.
+func ms(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
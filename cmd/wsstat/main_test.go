@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relaytools/go-wsstat"
+	"github.com/relaytools/go-wsstat/internal/wstest"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestRunOutputFormats(t *testing.T) {
+	url := wstest.NewEchoServer(t).String()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-text", "hi there", url}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Response: hi there") || !strings.Contains(stdout.String(), "WS handshake:") {
+		t.Errorf("Unexpected pretty output: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-o", "json", "-json", `{"a":1}`, url}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+	var out struct {
+		Result   json.RawMessage `json:"result"`
+		Response string          `json:"response"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if out.Response != `{"a":1}` {
+		t.Errorf("Unexpected response: %s", out.Response)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-o", "csv", "-ping", "-n", "3", "-interval", "0", url}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+	records, err := csv.NewReader(&stdout).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV output: %v", err)
+	}
+	if len(records) != 2 || records[0][0] != "url" || records[1][0] != url {
+		t.Errorf("Unexpected CSV output: %v", records)
+	}
+	if records[0][len(records[0])-1] != "rtt_jitter_ms" {
+		t.Errorf("Expected round-trip statistics columns: %v", records[0])
+	}
+}
+
+func TestRunAllAddresses(t *testing.T) {
+	url := wstest.NewEchoServer(t).String()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-all-ips", "-o", "json", "-ping", url}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+	var out []struct {
+		IP     string        `json:"ip"`
+		Result wsstat.Result `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(out) != 1 || out[0].IP != "127.0.0.1" || !strings.HasPrefix(out[0].Result.RemoteAddr, "127.0.0.1:") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+// startDNSServer starts a UDP DNS server answering A queries for echo.test with 127.0.0.1,
+// and returns its address.
+func startDNSServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if msg.Unpack(buf[:n]) != nil {
+				continue
+			}
+			msg.Header.Response = true
+			if q := msg.Questions[0]; q.Name.String() != "echo.test." {
+				msg.Header.RCode = dnsmessage.RCodeNameError
+			} else if q.Type == dnsmessage.TypeA {
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				})
+			}
+			reply, _ := msg.Pack()
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestRunAllAddressesResolver(t *testing.T) {
+	u := wstest.NewEchoServer(t)
+	u.Host = "echo.test:" + u.Port()
+
+	// echo.test only resolves with the resolver of the flags
+	var stdout, stderr bytes.Buffer
+	args := []string{"-all-ips", "-4", "-resolver", "udp://" + startDNSServer(t), "-o", "json", "-ping", u.String()}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+	var out []struct {
+		IP string `json:"ip"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(out) != 1 || out[0].IP != "127.0.0.1" {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+func TestRunCompareCompression(t *testing.T) {
+	url := wstest.NewEchoServer(t).String()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-compare-compression", "-n", "2", "-o", "json", url}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+	var out wsstat.CompressionReport
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	// The echo server does not enable compression
+	if out.Negotiated || out.Plain.PayloadBytes != 2*2*int64(len("Hello, WebSocket!")) || out.Plain.WireBytes == 0 {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+func TestRunMatch(t *testing.T) {
+	url := wstest.NewEchoServer(t).String()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-o", "json", "-json", `{"id":1}`, "-match-json", "id=1", url}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+
+	// The echo of a message that does not match is skipped until the read times out
+	stdout.Reset()
+	if code := run([]string{"-o", "json", "-timeout", "200ms", "-match", "^pong$", url}, &stdout, &stderr); code != exitCodes[wsstat.PhaseRead] {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitCodes[wsstat.PhaseRead], code, stderr.String())
+	}
+	var out struct {
+		Result wsstat.Result `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil || out.Result.SkippedMessages != 1 {
+		t.Errorf("Expected 1 skipped message, got %s: %v", stdout.String(), err)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedURL := "ws://" + listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"no URL", []string{}, exitUsage},
+		{"bad scheme", []string{"http://localhost"}, exitUsage},
+		{"bad JSON", []string{"-json", "{", "ws://localhost"}, exitUsage},
+		{"bad header", []string{"-H", "NoColon", "ws://localhost"}, exitUsage},
+		{"both families", []string{"-4", "-6", "ws://localhost"}, exitUsage},
+		{"bad resolver", []string{"-resolver", "8.8.8.8", "ws://localhost"}, exitUsage},
+		{"resume without TLS", []string{"-resume", "ws://localhost"}, exitUsage},
+		{"bad proxy", []string{"-proxy", "ftp://proxy", "ws://localhost"}, exitUsage},
+		{"bad certificate password", []string{"-cert", "../../testdata/client.p12", "-cert-password", "wrong", "wss://localhost"}, exitUsage},
+		{"compare compression with ping", []string{"-compare-compression", "-ping", "ws://localhost"}, exitUsage},
+		{"key without certificate", []string{"-key", "client.key", "wss://localhost"}, exitUsage},
+		{"bad match expression", []string{"-match", "(", "ws://localhost"}, exitUsage},
+		{"bad JSON match", []string{"-match-json", "id", "ws://localhost"}, exitUsage},
+		{"proxy", []string{"-proxy", "http" + strings.TrimPrefix(closedURL, "ws"), "ws://localhost"}, exitCodes[wsstat.PhaseTCP]},
+		{"DNS", []string{"ws://host.invalid"}, exitCodes[wsstat.PhaseDNS]},
+		{"TCP", []string{closedURL}, exitCodes[wsstat.PhaseTCP]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("Expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+		})
+	}
+}
+
+func TestWriteCSVColumns(t *testing.T) {
+	sampled := wsstat.Result{Stats: wsstat.NewLatencyStats([]time.Duration{time.Millisecond, 3 * time.Millisecond})}
+	var out bytes.Buffer
+	if err := writeCSV(&out, wsstat.Result{}, sampled); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV output: %v", err)
+	}
+	// The header has the statistics columns of the second result, which the first leaves empty
+	header := records[0]
+	if header[len(header)-1] != "rtt_jitter_ms" || len(records[1]) != len(header) || records[1][len(header)-1] != "" {
+		t.Errorf("Unexpected CSV output: %v", records)
+	}
+	if records[2][len(header)-1] != "2.000" {
+		t.Errorf("Expected the jitter of the second result, got %v", records[2])
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	h := headerFlags(http.Header{})
+	if err := h.Set("Authorization: Bearer abc:def"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := http.Header(h).Get("Authorization"); got != "Bearer abc:def" {
+		t.Errorf("Unexpected header value: %q", got)
+	}
+}
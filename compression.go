@@ -0,0 +1,100 @@
+package wsstat
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CompressionRun is the exchange of a set of payloads over one connection, see MeasureCompression.
+type CompressionRun struct {
+	Result       Result // Measurement of the connection, with Stats over the round trips
+	PayloadBytes int64  // Bytes of the messages sent and received
+	WireBytes    int64  // Bytes written and read on the connection during the exchange, framing and TLS included
+}
+
+// Ratio returns WireBytes divided by PayloadBytes, below 1 if the messages were compressed
+// by more than the framing overhead.
+func (r CompressionRun) Ratio() float64 {
+	if r.PayloadBytes == 0 {
+		return 0
+	}
+	return float64(r.WireBytes) / float64(r.PayloadBytes)
+}
+
+// CompressionReport compares exchanging the same payloads with and without permessage-deflate,
+// see MeasureCompression.
+type CompressionReport struct {
+	Plain      CompressionRun // Exchange without compression
+	Compressed CompressionRun // Exchange offering permessage-deflate
+	Negotiated bool           // Whether the server accepted permessage-deflate
+
+	Ratio             float64       // Compressed.WireBytes divided by Plain.WireBytes, below 1 if compression saves bytes
+	LatencyDifference time.Duration // Mean round trip with compression minus without, negative if compression is faster
+}
+
+// MeasureCompression measures whether permessage-deflate helps for the given payloads. It sends
+// the payloads as text messages over a connection without compression, then over one offering
+// permessage-deflate, and compares the bytes on the wire and the round-trip times of both.
+// Only the bytes of the message exchange are counted, not those of the handshakes.
+// If the server does not accept compression, both runs are uncompressed and Negotiated is false.
+func MeasureCompression(ctx context.Context, url *url.URL, payloads [][]byte, customHeaders http.Header, opts ...Option) (CompressionReport, error) {
+	var report CompressionReport
+	var err error
+	if report.Plain, err = exchangePayloads(ctx, url, payloads, customHeaders, opts...); err != nil {
+		return report, err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithCompression())
+	if report.Compressed, err = exchangePayloads(ctx, url, payloads, customHeaders, opts...); err != nil {
+		return report, err
+	}
+	for _, ext := range report.Compressed.Result.Extensions {
+		if ext.Name == "permessage-deflate" {
+			report.Negotiated = true
+		}
+	}
+	if report.Plain.WireBytes > 0 {
+		report.Ratio = float64(report.Compressed.WireBytes) / float64(report.Plain.WireBytes)
+	}
+	if plain, compressed := report.Plain.Result.Stats, report.Compressed.Result.Stats; plain != nil && compressed != nil {
+		report.LatencyDifference = compressed.Mean - plain.Mean
+	}
+	return report, nil
+}
+
+// exchangePayloads connects, sends each payload and awaits its response, and closes the connection.
+func exchangePayloads(ctx context.Context, url *url.URL, payloads [][]byte, customHeaders http.Header, opts ...Option) (CompressionRun, error) {
+	var run CompressionRun
+	ws := NewWSStat(opts...)
+	if err := ws.DialContext(ctx, url, customHeaders); err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
+		run.Result = *ws.Result
+		return run, err
+	}
+
+	before := ws.wire.total()
+	samples := make([]time.Duration, 0, len(payloads))
+	for _, payload := range payloads {
+		response, err := ws.SendMessageContext(ctx, websocket.TextMessage, payload)
+		if err != nil {
+			ws.conn.Close()
+			run.Result = *ws.Result
+			return run, err
+		}
+		samples = append(samples, ws.Result.MessageRoundTrip)
+		run.PayloadBytes += int64(len(payload) + len(response))
+	}
+	run.WireBytes = ws.wire.total() - before
+
+	if len(samples) > 0 {
+		ws.Result.MessageRoundTrip = samples[0]
+		ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + ws.Result.MessageRoundTrip
+		ws.Result.Stats = NewLatencyStats(samples)
+	}
+	ws.CloseConnContext(ctx)
+	run.Result = *ws.Result
+	return run, nil
+}
@@ -0,0 +1,59 @@
+package wsstat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMeasureCompression(t *testing.T) {
+	u := wsURL(t, startNegotiatingServer(t), "/")
+	payload := bytes.Repeat([]byte(`{"kind":1,"content":"hello relay"},`), 64)
+	payloads := [][]byte{payload, payload, payload}
+
+	r, err := MeasureCompression(context.Background(), u, payloads, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !r.Negotiated {
+		t.Error("Expected permessage-deflate to be negotiated")
+	}
+	if want := int64(2 * 3 * len(payload)); r.Plain.PayloadBytes != want || r.Compressed.PayloadBytes != want {
+		t.Errorf("Expected %d payload bytes, got %d and %d", want, r.Plain.PayloadBytes, r.Compressed.PayloadBytes)
+	}
+	if r.Plain.Ratio() <= 1 {
+		t.Errorf("Expected framing overhead without compression, got ratio %f", r.Plain.Ratio())
+	}
+	if r.Ratio >= 0.5 || r.Compressed.WireBytes >= r.Plain.WireBytes {
+		t.Errorf("Expected compression to save bytes: %d plain, %d compressed", r.Plain.WireBytes, r.Compressed.WireBytes)
+	}
+	if r.Compressed.Result.Stats == nil || len(r.Compressed.Result.Stats.Samples) != 3 {
+		t.Errorf("Expected statistics over 3 round trips")
+	}
+	if r.LatencyDifference != r.Compressed.Result.Stats.Mean-r.Plain.Result.Stats.Mean {
+		t.Errorf("Unexpected latency difference: %v", r.LatencyDifference)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Failed to marshal report: %v", err)
+	}
+	var decoded CompressionReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal report: %v", err)
+	}
+	if decoded.Ratio != r.Ratio || decoded.Compressed.WireBytes != r.Compressed.WireBytes || !decoded.Negotiated {
+		t.Errorf("Unexpected decoded report: %s", data)
+	}
+
+	// The test echo server does not support compression
+	r, err = MeasureCompression(context.Background(), echoServerAddrWs, payloads, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.Negotiated {
+		t.Error("Expected compression not to be negotiated")
+	}
+}
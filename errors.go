@@ -0,0 +1,103 @@
+package wsstat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Phase identifies a phase of a WebSocket measurement.
+type Phase int
+
+// Phases of a WebSocket measurement, in the order they occur.
+const (
+	PhaseNone      Phase = iota // No phase, the measurement did not fail
+	PhaseDNS                    // Resolving the host name
+	PhaseTCP                    // Establishing the TCP connection
+	PhaseProxy                  // Opening the tunnel through the proxy
+	PhaseTLS                    // Performing the TLS handshake
+	PhaseWSUpgrade              // Performing the WebSocket handshake
+	PhaseWrite                  // Writing a message
+	PhaseRead                   // Awaiting the response
+	PhaseClose                  // Closing the connection
+)
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	switch p {
+	case PhaseNone:
+		return "none"
+	case PhaseDNS:
+		return "dns"
+	case PhaseTCP:
+		return "tcp"
+	case PhaseProxy:
+		return "proxy"
+	case PhaseTLS:
+		return "tls"
+	case PhaseWSUpgrade:
+		return "ws_upgrade"
+	case PhaseWrite:
+		return "write"
+	case PhaseRead:
+		return "read"
+	case PhaseClose:
+		return "close"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// MarshalText encodes the phase as its name.
+func (p Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a phase from its name.
+func (p *Phase) UnmarshalText(text []byte) error {
+	for phase := PhaseNone; phase <= PhaseClose; phase++ {
+		if phase.String() == string(text) {
+			*p = phase
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown phase %q", text)
+}
+
+// PhaseError is returned when a measurement fails, recording the phase in which it failed.
+// The timings of the phases that completed before the failure remain set in the Result.
+type PhaseError struct {
+	Phase Phase // Phase in which the error occurred
+	Err   error // The underlying error
+}
+
+// Error returns the phase and the underlying error message.
+func (e *PhaseError) Error() string {
+	return fmt.Sprintf("%s phase failed: %v", e.Phase, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPhase returns the phase in which err occurred, or PhaseNone if err is not a PhaseError.
+func ErrorPhase(err error) Phase {
+	var phaseErr *PhaseError
+	if errors.As(err, &phaseErr) {
+		return phaseErr.Phase
+	}
+	return PhaseNone
+}
+
+// fail records the phase of err in the Result and returns err wrapped in a PhaseError.
+// Errors that already carry a phase keep it; others are attributed to the given phase.
+func (ws *WSStat) fail(phase Phase, err error) error {
+	var phaseErr *PhaseError
+	if !errors.As(err, &phaseErr) {
+		phaseErr = &PhaseError{Phase: phase, Err: err}
+		err = phaseErr
+	}
+	ws.Result.FailedPhase = phaseErr.Phase
+	ws.Result.Wire = ws.wire.stats()
+	return err
+}
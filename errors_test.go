@@ -0,0 +1,102 @@
+package wsstat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPhaseError(t *testing.T) {
+	cause := errors.New("handshake failure")
+	var err error = &PhaseError{Phase: PhaseTLS, Err: cause}
+
+	if !errors.Is(err, cause) {
+		t.Error("Expected PhaseError to unwrap to its cause")
+	}
+	if ErrorPhase(err) != PhaseTLS {
+		t.Errorf("Unexpected phase: %s", ErrorPhase(err))
+	}
+	if ErrorPhase(cause) != PhaseNone {
+		t.Errorf("Unexpected phase for plain error: %s", ErrorPhase(cause))
+	}
+	if err.Error() != "tls phase failed: handshake failure" {
+		t.Errorf("Unexpected error message: %s", err)
+	}
+}
+
+func TestMeasureLatencyFailedPhase(t *testing.T) {
+	// A listener that is closed right away gives an address that refuses connections
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name  string
+		url   string
+		phase Phase
+	}{
+		{"DNS", "ws://host.invalid/echo", PhaseDNS},
+		{"TCP", "ws://" + closedAddr + "/echo", PhaseTCP},
+		{"TLS", "wss://" + serverAddr + "/echo", PhaseTLS},
+		{"WSUpgrade", "ws://" + serverAddr + "/not-found", PhaseWSUpgrade},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+			result, _, err := MeasureLatency(u, "Hello, world!", http.Header{})
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if ErrorPhase(err) != tt.phase {
+				t.Errorf("Expected phase %s, got %s (%v)", tt.phase, ErrorPhase(err), err)
+			}
+			if result.FailedPhase != tt.phase {
+				t.Errorf("Expected failed phase %s in result, got %s", tt.phase, result.FailedPhase)
+			}
+			// Phases preceding the failed one keep their times
+			if tt.phase > PhaseDNS && result.DNSLookup <= 0 {
+				t.Errorf("Expected DNSLookup time to be kept, got %v", result.DNSLookup)
+			}
+			if tt.phase > PhaseTCP && result.TCPConnection <= 0 {
+				t.Errorf("Expected TCPConnection time to be kept, got %v", result.TCPConnection)
+			}
+		})
+	}
+}
+
+func TestMeasureLatencyReadFailure(t *testing.T) {
+	result, _, err := MeasureLatency(silentServerAddrWs, "Hello, world!", http.Header{},
+		WithReadTimeout(100*time.Millisecond))
+	if ErrorPhase(err) != PhaseRead {
+		t.Fatalf("Expected read phase error, got: %v", err)
+	}
+	if result.FailedPhase != PhaseRead {
+		t.Errorf("Unexpected failed phase: %s", result.FailedPhase)
+	}
+	if result.WSHandshakeDone <= 0 {
+		t.Errorf("Expected WSHandshakeDone time to be kept, got %v", result.WSHandshakeDone)
+	}
+}
+
+func TestMeasureLatencyCanceledPhase(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := MeasureLatencyPingContext(ctx, echoServerAddrWs, http.Header{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	if result.FailedPhase == PhaseNone {
+		t.Error("Expected a failed phase to be recorded")
+	}
+}
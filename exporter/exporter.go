@@ -0,0 +1,308 @@
+// Package exporter continuously probes WebSocket targets with wsstat and exposes the
+// results as Prometheus metrics.
+//
+// Configured targets are probed on an interval and reported on the metrics handler.
+// Like the Prometheus blackbox exporter, the probe handler also measures an arbitrary
+// target on request, e.g. /probe?target=wss://relay.example.com.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/relaytools/go-wsstat"
+)
+
+const namespace = "wsstat"
+
+// Target is a WebSocket endpoint to probe.
+type Target struct {
+	Name    string          // Value of the target label, defaults to the URL
+	URL     *url.URL        // URL of the WebSocket endpoint
+	Message string          // Text message to send; a ping is sent if empty
+	Headers http.Header     // Additional headers to send with the handshake
+	Options []wsstat.Option // Options for the WSStat instance of each probe
+}
+
+// label returns the value of the target label.
+func (t Target) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.URL.String()
+}
+
+// Config configures an Exporter.
+type Config struct {
+	Targets  []Target      // Targets to probe continuously
+	Interval time.Duration // Pause between probes of a target, defaults to 30s
+	Timeout  time.Duration // Timeout of a single probe, defaults to 10s
+
+	ProbeOptions []wsstat.Option // Options for the targets probed through ProbeHandler
+}
+
+// Exporter probes WebSocket targets and records the results as Prometheus metrics.
+type Exporter struct {
+	cfg      Config
+	registry *prometheus.Registry
+	metrics  *metrics
+}
+
+// metrics holds the metrics recorded for continuously probed targets.
+type metrics struct {
+	phaseDuration *prometheus.HistogramVec
+	probes        *prometheus.CounterVec
+	failures      *prometheus.CounterVec
+	certExpiry    *prometheus.GaugeVec
+	certVerified  *prometheus.GaugeVec
+}
+
+// New returns an Exporter for the given configuration. Call Run to start probing.
+func New(cfg Config) *Exporter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	m := &metrics{
+		phaseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "phase_duration_seconds",
+			Help:      "Duration of each phase of the WebSocket connection.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"target", "phase"}),
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "probes_total",
+			Help:      "Number of probes of the target.",
+		}, []string{"target"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "probe_failures_total",
+			Help:      "Number of failed probes of the target, by the phase that failed.",
+		}, []string{"target", "phase"}),
+		certExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tls_earliest_cert_expiry_seconds",
+			Help:      "Unix time at which the first certificate of the chain expires.",
+		}, []string{"target"}),
+		certVerified: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tls_cert_verified",
+			Help:      "Whether the certificate chain verified and matched the host name.",
+		}, []string{"target"}),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.phaseDuration, m.probes, m.failures, m.certExpiry, m.certVerified)
+
+	return &Exporter{cfg: cfg, registry: registry, metrics: m}
+}
+
+// Registry returns the registry holding the metrics of the continuously probed targets.
+func (e *Exporter) Registry() *prometheus.Registry {
+	return e.registry
+}
+
+// Run probes every configured target on the configured interval until the context is done.
+func (e *Exporter) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range e.cfg.Targets {
+		wg.Add(1)
+		go func(target Target) {
+			defer wg.Done()
+			ticker := time.NewTicker(e.cfg.Interval)
+			defer ticker.Stop()
+			for {
+				e.probeOnce(ctx, target)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(target)
+	}
+	wg.Wait()
+}
+
+// probeOnce probes the target and records the result in the exporter's metrics.
+func (e *Exporter) probeOnce(ctx context.Context, target Target) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	result, err := Probe(ctx, target)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return // Shutting down, not a failure of the target
+	}
+
+	name := target.label()
+	e.metrics.probes.WithLabelValues(name).Inc()
+	if err != nil {
+		e.metrics.failures.WithLabelValues(name, wsstat.ErrorPhase(err).String()).Inc()
+	}
+	for _, p := range completedPhases(result) {
+		e.metrics.phaseDuration.WithLabelValues(name, p.name).Observe(p.duration.Seconds())
+	}
+	if expiry, ok := earliestExpiry(result); ok {
+		e.metrics.certExpiry.WithLabelValues(name).Set(float64(expiry.Unix()))
+	}
+	if verified, ok := certVerified(result); ok {
+		e.metrics.certVerified.WithLabelValues(name).Set(verified)
+	}
+}
+
+// Handler returns an HTTP handler serving the metrics of the continuously probed targets.
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// ProbeHandler returns an HTTP handler that probes the target given in the query and serves the
+// result as metrics, blackbox-exporter style. Query parameters:
+//
+//	target   URL of the WebSocket endpoint, required
+//	message  text message to send, a ping is sent if omitted
+//	timeout  probe timeout as a Go duration, defaults to the configured timeout
+func (e *Exporter) ProbeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		targetURL, err := url.Parse(query.Get("target"))
+		if err != nil || (targetURL.Scheme != "ws" && targetURL.Scheme != "wss") {
+			http.Error(w, "target parameter must be a ws:// or wss:// URL", http.StatusBadRequest)
+			return
+		}
+		timeout := e.cfg.Timeout
+		if raw := query.Get("timeout"); raw != "" {
+			if timeout, err = time.ParseDuration(raw); err != nil {
+				http.Error(w, "invalid timeout parameter: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		start := time.Now()
+		result, err := Probe(ctx, Target{URL: targetURL, Message: query.Get("message"), Options: e.cfg.ProbeOptions})
+
+		registry := prometheus.NewRegistry()
+		success := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "probe_success",
+			Help:      "Whether the probe succeeded.",
+		})
+		duration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "probe_duration_seconds",
+			Help:      "Duration of the probe.",
+		})
+		phaseDuration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "probe_phase_duration_seconds",
+			Help:      "Duration of each phase of the WebSocket connection.",
+		}, []string{"phase"})
+		failedPhase := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "probe_failed_phase",
+			Help:      "Set to 1 for the phase in which the probe failed.",
+		}, []string{"phase"})
+		certExpiry := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "probe_tls_earliest_cert_expiry_seconds",
+			Help:      "Unix time at which the first certificate of the chain expires.",
+		})
+		certVerifiedGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "probe_tls_cert_verified",
+			Help:      "Whether the certificate chain verified and matched the host name.",
+		})
+		registry.MustRegister(success, duration, phaseDuration, failedPhase)
+
+		duration.Set(time.Since(start).Seconds())
+		if err == nil {
+			success.Set(1)
+		} else {
+			failedPhase.WithLabelValues(wsstat.ErrorPhase(err).String()).Set(1)
+		}
+		for _, p := range completedPhases(result) {
+			phaseDuration.WithLabelValues(p.name).Set(p.duration.Seconds())
+		}
+		if expiry, ok := earliestExpiry(result); ok {
+			registry.MustRegister(certExpiry)
+			certExpiry.Set(float64(expiry.Unix()))
+		}
+		if verified, ok := certVerified(result); ok {
+			registry.MustRegister(certVerifiedGauge)
+			certVerifiedGauge.Set(verified)
+		}
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// Probe measures the target once, sending its message or a ping.
+func Probe(ctx context.Context, target Target) (wsstat.Result, error) {
+	headers := target.Headers
+	if headers == nil {
+		headers = http.Header{}
+	}
+	if target.Message == "" {
+		return wsstat.MeasureLatencyPingContext(ctx, target.URL, headers, target.Options...)
+	}
+	result, _, err := wsstat.MeasureLatencyContext(ctx, target.URL, target.Message, headers, target.Options...)
+	return result, err
+}
+
+// phaseDuration is the duration of a phase, with its label value.
+type phaseDuration struct {
+	name     string
+	duration time.Duration
+}
+
+// completedPhases returns the durations of the phases the result completed.
+// The TLS phase is omitted for ws:// targets.
+func completedPhases(result wsstat.Result) []phaseDuration {
+	var phases []phaseDuration
+	add := func(name string, d time.Duration, done bool) {
+		if done {
+			phases = append(phases, phaseDuration{name, d})
+		}
+	}
+	add("dns", result.DNSLookup, result.DNSLookupDone > 0)
+	add("tcp", result.TCPConnection, result.TCPConnected > 0)
+	add("proxy", result.ProxyConnect, result.ProxyConnected > 0)
+	add("tls", result.TLSHandshake, result.TLSHandshakeDone > 0)
+	add("ws_upgrade", result.WSHandshake, result.WSHandshakeDone > 0)
+	add("message_round_trip", result.MessageRoundTrip, result.FirstMessageResponse > 0)
+	add("close", result.ConnectionClose, result.TotalTime > 0)
+	return phases
+}
+
+// certVerified returns 1 if the result's certificate chain verified and matched the host name, 0 if not.
+// It reports false if the result has no certificate report.
+func certVerified(result wsstat.Result) (float64, bool) {
+	report := result.CertificateReport
+	if report == nil {
+		return 0, false
+	}
+	if report.Verified && report.HostnameMatch {
+		return 1, true
+	}
+	return 0, true
+}
+
+// earliestExpiry returns the earliest NotAfter of the result's certificates.
+func earliestExpiry(result wsstat.Result) (time.Time, bool) {
+	var earliest time.Time
+	for _, cert := range result.CertificateDetails() {
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/relaytools/go-wsstat"
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+var insecure = wsstat.WithTLSConfig(&tls.Config{InsecureSkipVerify: true})
+
+func TestExporterRun(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedURL, _ := url.Parse("ws://" + listener.Addr().String())
+	listener.Close()
+
+	exp := New(Config{
+		Targets: []Target{
+			{Name: "echo", URL: wstest.NewTLSEchoServer(t), Options: []wsstat.Option{insecure}},
+			{Name: "closed", URL: closedURL},
+		},
+		Interval: time.Hour,
+		Timeout:  2 * time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		exp.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(exp.metrics.probes.WithLabelValues("echo"))+
+		testutil.ToFloat64(exp.metrics.probes.WithLabelValues("closed")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for probes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := testutil.ToFloat64(exp.metrics.failures.WithLabelValues("closed", "tcp")); got != 1 {
+		t.Errorf("Expected one tcp failure for closed target, got %v", got)
+	}
+	if got := testutil.CollectAndCount(exp.metrics.failures); got != 1 {
+		t.Errorf("Expected failures for one target only, got %d series", got)
+	}
+	// dns, tcp, tls, ws_upgrade, message_round_trip, close for echo; dns for closed
+	if got := testutil.CollectAndCount(exp.metrics.phaseDuration); got != 7 {
+		t.Errorf("Expected 7 phase duration series, got %d", got)
+	}
+	if got := testutil.ToFloat64(exp.metrics.certExpiry.WithLabelValues("echo")); got < float64(time.Now().Unix()) {
+		t.Errorf("Expected certificate expiry in the future, got %v", got)
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	exp := New(Config{ProbeOptions: []wsstat.Option{insecure}})
+	server := httptest.NewServer(exp.ProbeHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?message=hello&target=" + url.QueryEscape(wstest.NewTLSEchoServer(t).String()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		"wsstat_probe_success 1",
+		`wsstat_probe_phase_duration_seconds{phase="tls"}`,
+		`wsstat_probe_phase_duration_seconds{phase="message_round_trip"}`,
+		"wsstat_probe_tls_earliest_cert_expiry_seconds",
+		"wsstat_probe_tls_cert_verified 0", // The test certificate is not trusted by the system roots
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %s in response:\n%s", want, body)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "?target=ws://host.invalid")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{"wsstat_probe_success 0", `wsstat_probe_failed_phase{phase="dns"} 1`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %s in response:\n%s", want, body)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "?target=http://example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected bad request for non-WebSocket target, got %d", resp.StatusCode)
+	}
+}
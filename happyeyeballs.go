@@ -0,0 +1,158 @@
+package wsstat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// defaultFallbackDelay is the head start of the preferred address family, as recommended by RFC 8305.
+const defaultFallbackDelay = 250 * time.Millisecond
+
+// ErrRaceLost is the LoserErr of a FamilyRace whose losing attempt was abandoned,
+// because the other address family connected first.
+var ErrRaceLost = errors.New("abandoned after the other address family connected")
+
+// FamilyRace is the outcome of a Happy Eyeballs race between IPv6 and IPv4, see WithHappyEyeballs.
+type FamilyRace struct {
+	Winner        string        // Network of the attempt that connected first, "tcp6" or "tcp4"
+	Loser         string        // Network of the other attempt
+	LoserDuration time.Duration // Time the losing attempt ran, zero if it never started
+	LoserErr      error         // Error of the losing attempt, ErrRaceLost if it was abandoned, nil if it connected too late
+}
+
+// familyAttempt is the outcome of connecting to the addresses of one family.
+type familyAttempt struct {
+	network  string
+	conn     net.Conn
+	err      error
+	duration time.Duration
+}
+
+// raceFamilies connects to one of addrs per RFC 8305. The family of the first address, which
+// the resolver sorts by preference, gets a head start of delay before the other family is tried
+// in parallel; the other family starts at once if the first fails. Addresses of the same family
+// are tried in order. The returned FamilyRace is nil if addrs holds a single family.
+func raceFamilies(ctx context.Context, dialer *net.Dialer, addrs []string, port string, delay time.Duration) (net.Conn, *FamilyRace, error) {
+	primary, fallback := splitFamilies(addrs)
+	if len(fallback) == 0 {
+		conn, err := dialSerial(ctx, dialer, family(primary[0]), primary, port)
+		return conn, nil, err
+	}
+	if delay <= 0 {
+		delay = defaultFallbackDelay
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	attempts := make(chan familyAttempt, 2)
+	start := func(addrs []string) {
+		go func() {
+			attemptStart := time.Now()
+			conn, err := dialSerial(ctx, dialer, family(addrs[0]), addrs, port)
+			attempts <- familyAttempt{family(addrs[0]), conn, err, time.Since(attemptStart)}
+		}()
+	}
+
+	start(primary)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	fallbackTimer := timer.C
+	running := 1
+	var failed []familyAttempt
+	for {
+		select {
+		case <-fallbackTimer:
+			fallbackTimer = nil
+			start(fallback)
+			running++
+		case a := <-attempts:
+			running--
+			if a.err != nil {
+				failed = append(failed, a)
+				if len(failed) == 2 {
+					return nil, nil, errors.Join(failed[0].err, failed[1].err)
+				}
+				if fallbackTimer != nil {
+					fallbackTimer = nil
+					start(fallback)
+					running++
+				}
+				continue
+			}
+
+			race := &FamilyRace{Winner: a.network, Loser: family(fallback[0])}
+			if a.network == race.Loser {
+				race.Loser = family(primary[0])
+			}
+			switch {
+			case len(failed) > 0:
+				race.LoserDuration, race.LoserErr = failed[0].duration, failed[0].err
+			case running > 0:
+				cancel()
+				loser := <-attempts
+				race.LoserDuration, race.LoserErr = loser.duration, loser.err
+				if loser.conn != nil {
+					loser.conn.Close()
+				}
+				if errors.Is(loser.err, context.Canceled) {
+					race.LoserErr = ErrRaceLost
+				}
+			default:
+				race.LoserErr = ErrRaceLost
+			}
+			return a.conn, race, nil
+		}
+	}
+}
+
+// dialSerial connects to the first reachable address of addrs, and returns the first error if none is.
+func dialSerial(ctx context.Context, dialer *net.Dialer, network string, addrs []string, port string) (net.Conn, error) {
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// splitFamilies splits addrs into those of the family of the first address and the others.
+func splitFamilies(addrs []string) (primary, fallback []string) {
+	for _, addr := range addrs {
+		if family(addr) == family(addrs[0]) {
+			primary = append(primary, addr)
+		} else {
+			fallback = append(fallback, addr)
+		}
+	}
+	return primary, fallback
+}
+
+// family returns the network of an IP address, "tcp4" or "tcp6".
+func family(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "tcp6"
+	}
+	return "tcp4"
+}
+
+// lookupNetwork returns the network to resolve the addresses of a dial network with.
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4":
+		return "ip4"
+	case "tcp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
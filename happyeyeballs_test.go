@@ -0,0 +1,94 @@
+package wsstat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// listenPort listens on the loopback address of the given network and returns the listener's port.
+func listenPort(t *testing.T, network, addr string) string {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		t.Skipf("Cannot listen on %s: %v", addr, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+func TestRaceFamiliesFallback(t *testing.T) {
+	port := listenPort(t, "tcp4", "127.0.0.1:0")
+
+	// Nothing listens on the IPv6 port, so IPv4 starts at once instead of after the delay
+	start := time.Now()
+	conn, race, err := raceFamilies(context.Background(), &net.Dialer{}, []string{"::1", "127.0.0.1"}, port, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if time.Since(start) > 10*time.Second {
+		t.Error("Expected the fallback to start when the preferred family failed")
+	}
+	if race == nil || race.Winner != "tcp4" || race.Loser != "tcp6" {
+		t.Fatalf("Unexpected race outcome: %+v", race)
+	}
+	if race.LoserErr == nil || errors.Is(race.LoserErr, ErrRaceLost) {
+		t.Errorf("Expected the dial error of the losing family, got %v", race.LoserErr)
+	}
+}
+
+func TestRaceFamiliesPreferred(t *testing.T) {
+	port := listenPort(t, "tcp6", "[::1]:0")
+
+	conn, race, err := raceFamilies(context.Background(), &net.Dialer{}, []string{"::1", "127.0.0.1"}, port, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if race == nil || race.Winner != "tcp6" || race.LoserErr != ErrRaceLost || race.LoserDuration != 0 {
+		t.Errorf("Unexpected race outcome: %+v", race)
+	}
+
+	// A single family is not raced
+	_, race, err = raceFamilies(context.Background(), &net.Dialer{}, []string{"::1"}, port, 0)
+	if err != nil || race != nil {
+		t.Errorf("Expected no race for a single family, got %+v, %v", race, err)
+	}
+}
+
+func TestWithNetwork(t *testing.T) {
+	u, _ := url.Parse("ws://localhost:8080/echo")
+	result, err := MeasureLatencyPing(u, http.Header{}, WithNetwork("tcp4"), WithHappyEyeballs(0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, ip := range result.IPs {
+		if family(ip) != "tcp4" {
+			t.Errorf("Expected IPv4 addresses only, got %v", result.IPs)
+		}
+	}
+	if result.FamilyRace != nil {
+		t.Errorf("Expected no race with a single family, got %+v", result.FamilyRace)
+	}
+}
+
+func TestFamilyRaceJSON(t *testing.T) {
+	result := Result{FamilyRace: &FamilyRace{Winner: "tcp4", Loser: "tcp6", LoserDuration: time.Second, LoserErr: ErrRaceLost}}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if race := decoded.FamilyRace; race == nil || *race != *result.FamilyRace {
+		t.Errorf("Unexpected family race: %+v", decoded.FamilyRace)
+	}
+}
@@ -0,0 +1,36 @@
+package wsstat
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// HTTPClient returns an HTTP client for requests to the server of the WebSocket connection, such
+// as for a document the server publishes next to its endpoint. It connects to the address of the
+// connection, Result.RemoteAddr, instead of resolving the host again, or through the same proxy
+// or dial function, and uses the same TLS configuration. Its TLS handshakes resume the session of
+// the connection where the server issued a session ticket. Each request uses a new connection,
+// closed with the response, so that the client leaves no idle connection open. Call it after Dial.
+func (ws *WSStat) HTTPClient() *http.Client {
+	cfg := ws.cfg
+	remoteAddr := ws.Result.RemoteAddr
+	transport := &http.Transport{
+		TLSClientConfig:   cfg.clientTLSConfig(),
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if cfg.dialFunc != nil {
+				return cfg.dialFunc(ctx, network, addr)
+			}
+			if cfg.proxy == nil && remoteAddr != "" {
+				addr = remoteAddr
+			}
+			dialer := &net.Dialer{Timeout: cfg.dialTimeout}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	if cfg.proxy != nil {
+		transport.Proxy = http.ProxyURL(cfg.proxy)
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,53 @@
+package wsstat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+func TestHTTPClient(t *testing.T) {
+	server, tlsConfig := wstest.StartTLSEchoServer(t)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			wstest.EchoHandler(w, r)
+			return
+		}
+		io.WriteString(w, "document")
+	})
+
+	ws := NewWSStat(WithTLSConfig(tlsConfig))
+	url := wsURL(t, server, "/")
+	if err := ws.DialContext(context.Background(), url, http.Header{}); err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer ws.CloseConn()
+
+	req, err := http.NewRequest(http.MethodGet, strings.Replace(url.String(), "wss", "https", 1), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := ws.HTTPClient().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "document" {
+		t.Errorf("Unexpected body: %q", body)
+	}
+	if !resp.Close {
+		t.Error("Expected the connection to be closed with the response")
+	}
+	// The server sent a session ticket with the handshake of the WebSocket connection
+	if !resp.TLS.DidResume {
+		t.Error("Expected the TLS session to be resumed")
+	}
+	if tlsConfig.ClientSessionCache != nil {
+		t.Error("Expected the TLS configuration to be left unchanged")
+	}
+}
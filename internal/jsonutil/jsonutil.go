@@ -0,0 +1,33 @@
+// Package jsonutil provides the JSON encodings shared by wsstat and its protocol packages.
+package jsonutil
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration encodes a time.Duration as both nanoseconds and milliseconds.
+type Duration time.Duration
+
+type durationFields struct {
+	Ns int64   `json:"ns"`
+	Ms float64 `json:"ms"`
+}
+
+// MarshalJSON encodes the duration as {"ns": ..., "ms": ...}.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(durationFields{
+		Ns: int64(d),
+		Ms: float64(d) / float64(time.Millisecond),
+	})
+}
+
+// UnmarshalJSON decodes the duration from its nanoseconds, which are exact.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var fields durationFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*d = Duration(fields.Ns)
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package wstest provides the WebSocket test servers shared by the tests of wsstat and its commands.
+package wstest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// EchoHandler upgrades the connection and echoes back any received messages.
+func EchoHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		mt, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(mt, message); err != nil {
+			return
+		}
+	}
+}
+
+// NewEchoServer starts a ws:// server running EchoHandler, closed when the test ends,
+// and returns its URL.
+func NewEchoServer(t testing.TB) *url.URL {
+	server := httptest.NewServer(http.HandlerFunc(EchoHandler))
+	t.Cleanup(server.Close)
+	return URL(t, server)
+}
+
+// NewTLSEchoServer is like NewEchoServer but starts a wss:// server, whose certificate
+// is not trusted by default.
+func NewTLSEchoServer(t testing.TB) *url.URL {
+	server, _ := StartTLSEchoServer(t)
+	return URL(t, server)
+}
+
+// StartTLSEchoServer starts a wss:// server running EchoHandler with a self-signed certificate.
+// Returns the server, closed when the test ends, and a TLS config trusting its certificate.
+func StartTLSEchoServer(t testing.TB) (*httptest.Server, *tls.Config) {
+	server := httptest.NewTLSServer(http.HandlerFunc(EchoHandler))
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server, &tls.Config{RootCAs: roots}
+}
+
+// URL returns the WebSocket URL of a test server.
+func URL(t testing.TB, server *httptest.Server) *url.URL {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	return u
+}
@@ -0,0 +1,604 @@
+package wsstat
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat/internal/jsonutil"
+)
+
+// resultJSON is the JSON representation of Result.
+type resultJSON struct {
+	URL         string     `json:"url"`
+	IPs         []string   `json:"ips"`
+	RemoteAddr  string     `json:"remote_addr,omitempty"`
+	Transport   string     `json:"transport,omitempty"`
+	FamilyRace  *raceJSON  `json:"family_race,omitempty"`
+	DNS         *dnsJSON   `json:"dns,omitempty"`
+	Start       *time.Time `json:"start,omitempty"`
+	FailedPhase *Phase     `json:"failed_phase,omitempty"`
+
+	Durations map[string]jsonutil.Duration `json:"durations"`
+
+	TLS             *tlsJSON        `json:"tls,omitempty"`
+	ClientAuth      *clientAuthJSON `json:"client_auth,omitempty"`
+	RequestHeaders  http.Header     `json:"request_headers,omitempty"`
+	ResponseHeaders http.Header     `json:"response_headers,omitempty"`
+	StatusCode      int             `json:"status_code,omitempty"`
+	Subprotocol     string          `json:"subprotocol,omitempty"`
+	Extensions      []extensionJSON `json:"extensions,omitempty"`
+	Wire            *wireJSON       `json:"wire,omitempty"`
+	TCPInfo         *tcpInfosJSON   `json:"tcp_info,omitempty"`
+	SkippedMessages int             `json:"skipped_messages,omitempty"`
+	Skipped         []skippedJSON   `json:"skipped,omitempty"`
+	Stats           *statsJSON      `json:"stats,omitempty"`
+}
+
+// dnsJSON is the JSON representation of DNSAnswer.
+type dnsJSON struct {
+	Resolver string        `json:"resolver"`
+	Addrs    []dnsAddrJSON `json:"addrs"`
+	CNAMEs   []string      `json:"cnames,omitempty"`
+}
+
+// dnsAddrJSON is the JSON representation of DNSAddr.
+type dnsAddrJSON struct {
+	IP  string             `json:"ip"`
+	TTL *jsonutil.Duration `json:"ttl,omitempty"`
+}
+
+// raceJSON is the JSON representation of FamilyRace.
+type raceJSON struct {
+	Winner        string            `json:"winner"`
+	Loser         string            `json:"loser"`
+	LoserDuration jsonutil.Duration `json:"loser_duration"`
+	LoserError    string            `json:"loser_error,omitempty"`
+}
+
+// tlsJSON is the JSON representation of the TLS connection state.
+type tlsJSON struct {
+	Version            string            `json:"version"`
+	CipherSuite        string            `json:"cipher_suite"`
+	ServerName         string            `json:"server_name"`
+	HandshakeComplete  bool              `json:"handshake_complete"`
+	DidResume          bool              `json:"did_resume"`
+	NegotiatedProtocol string            `json:"negotiated_protocol,omitempty"`
+	Certificates       []certificateJSON `json:"certificates"`
+	Report             *certReportJSON   `json:"verification,omitempty"`
+}
+
+// certReportJSON is the JSON representation of CertificateReport.
+type certReportJSON struct {
+	Verified        bool      `json:"verified"`
+	VerifyError     string    `json:"verify_error,omitempty"`
+	Roots           string    `json:"roots"`
+	Chain           []string  `json:"chain,omitempty"`
+	HostnameMatch   bool      `json:"hostname_match"`
+	EarliestExpiry  time.Time `json:"earliest_expiry"`
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+	OCSPStatus      string    `json:"ocsp_status"`
+	SCTs            int       `json:"scts"`
+	Warnings        []string  `json:"warnings,omitempty"`
+}
+
+// clientAuthJSON is the JSON representation of ClientAuth.
+type clientAuthJSON struct {
+	Requested     bool     `json:"requested"`
+	AcceptableCAs []string `json:"acceptable_cas,omitempty"`
+	Sent          bool     `json:"sent"`
+	Subject       string   `json:"subject,omitempty"`
+}
+
+// wireJSON is the JSON representation of WireStats.
+type wireJSON struct {
+	Proxy     byteCountJSON             `json:"proxy"`
+	TLS       byteCountJSON             `json:"tls"`
+	WSUpgrade byteCountJSON             `json:"ws_upgrade"`
+	Messages  byteCountJSON             `json:"messages"`
+	Close     byteCountJSON             `json:"close"`
+	Sent      map[string]frameCountJSON `json:"frames_sent,omitempty"`
+	Received  map[string]frameCountJSON `json:"frames_received,omitempty"`
+}
+
+// byteCountJSON is the JSON representation of ByteCount.
+type byteCountJSON struct {
+	Written int64 `json:"written"`
+	Read    int64 `json:"read"`
+}
+
+// frameCountJSON is the JSON representation of FrameCount.
+type frameCountJSON struct {
+	Frames int   `json:"frames"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// tcpInfosJSON is the JSON representation of the TCPInfo snapshots of a Result.
+type tcpInfosJSON struct {
+	Handshake *tcpInfoJSON `json:"handshake,omitempty"`
+	Message   *tcpInfoJSON `json:"message,omitempty"`
+}
+
+// tcpInfoJSON is the JSON representation of TCPInfo.
+type tcpInfoJSON struct {
+	RTT         jsonutil.Duration `json:"rtt"`
+	RTTVar      jsonutil.Duration `json:"rtt_var"`
+	Retransmits uint32            `json:"retransmits"`
+	SndCwnd     uint32            `json:"snd_cwnd"`
+	SndMSS      uint32            `json:"snd_mss"`
+}
+
+// newTCPInfoJSON returns the JSON representation of info, or nil if info is nil.
+func newTCPInfoJSON(info *TCPInfo) *tcpInfoJSON {
+	if info == nil {
+		return nil
+	}
+	return &tcpInfoJSON{jsonutil.Duration(info.RTT), jsonutil.Duration(info.RTTVar), info.Retransmits, info.SndCwnd, info.SndMSS}
+}
+
+// tcpInfo returns the TCPInfo of its JSON representation, or nil if in is nil.
+func (in *tcpInfoJSON) tcpInfo() *TCPInfo {
+	if in == nil {
+		return nil
+	}
+	return &TCPInfo{time.Duration(in.RTT), time.Duration(in.RTTVar), in.Retransmits, in.SndCwnd, in.SndMSS}
+}
+
+// skippedJSON is the JSON representation of SkippedMessage. The payload of text messages is
+// encoded as a string, that of binary messages in base64.
+type skippedJSON struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Binary   []byte            `json:"binary,omitempty"`
+	Received jsonutil.Duration `json:"received"`
+}
+
+// extensionJSON is the JSON representation of Extension.
+type extensionJSON struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// certificateJSON is the JSON representation of CertificateDetails.
+type certificateJSON struct {
+	CommonName         string    `json:"common_name"`
+	Issuer             string    `json:"issuer"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	PublicKeyAlgorithm string    `json:"public_key_algorithm"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	DNSNames           []string  `json:"dns_names"`
+	IPAddresses        []string  `json:"ip_addresses"`
+	URIs               []string  `json:"uris"`
+}
+
+// statsJSON is the JSON representation of LatencyStats.
+type statsJSON struct {
+	Samples []jsonutil.Duration `json:"samples"`
+	Min     jsonutil.Duration   `json:"min"`
+	Max     jsonutil.Duration   `json:"max"`
+	Mean    jsonutil.Duration   `json:"mean"`
+	StdDev  jsonutil.Duration   `json:"stddev"`
+	P50     jsonutil.Duration   `json:"p50"`
+	P90     jsonutil.Duration   `json:"p90"`
+	P99     jsonutil.Duration   `json:"p99"`
+	Jitter  jsonutil.Duration   `json:"jitter"`
+}
+
+// MarshalJSON encodes the Result with stable snake_case keys.
+// Durations are encoded as objects holding both nanoseconds and milliseconds.
+func (r Result) MarshalJSON() ([]byte, error) {
+	out := resultJSON{
+		URL:             r.URL.String(),
+		IPs:             r.IPs,
+		RemoteAddr:      r.RemoteAddr,
+		Transport:       r.Transport,
+		Durations:       make(map[string]jsonutil.Duration),
+		RequestHeaders:  r.RequestHeaders,
+		ResponseHeaders: r.ResponseHeaders,
+		StatusCode:      r.StatusCode,
+		Subprotocol:     r.Subprotocol,
+	}
+	if !r.Start.IsZero() {
+		out.Start = &r.Start
+	}
+	if out.IPs == nil {
+		out.IPs = []string{}
+	}
+	if r.FailedPhase != PhaseNone {
+		out.FailedPhase = &r.FailedPhase
+	}
+	if r.DNS != nil {
+		out.DNS = &dnsJSON{
+			Resolver: r.DNS.Resolver,
+			Addrs:    make([]dnsAddrJSON, len(r.DNS.Addrs)),
+			CNAMEs:   r.DNS.CNAMEs,
+		}
+		for i, a := range r.DNS.Addrs {
+			out.DNS.Addrs[i].IP = a.IP.String()
+			if a.TTL > 0 {
+				ttl := jsonutil.Duration(a.TTL)
+				out.DNS.Addrs[i].TTL = &ttl
+			}
+		}
+	}
+	if r.FamilyRace != nil {
+		out.FamilyRace = &raceJSON{
+			Winner:        r.FamilyRace.Winner,
+			Loser:         r.FamilyRace.Loser,
+			LoserDuration: jsonutil.Duration(r.FamilyRace.LoserDuration),
+		}
+		if r.FamilyRace.LoserErr != nil {
+			out.FamilyRace.LoserError = r.FamilyRace.LoserErr.Error()
+		}
+	}
+	for _, d := range r.durations() {
+		// Durations of phases that do not apply to the transport are left out
+		if r.Applicable(d.phase) {
+			out.Durations[d.key] = jsonutil.Duration(*d.value)
+		}
+	}
+
+	if r.TLSState != nil {
+		out.TLS = &tlsJSON{
+			Version:            tls.VersionName(r.TLSState.Version),
+			CipherSuite:        tls.CipherSuiteName(r.TLSState.CipherSuite),
+			ServerName:         r.TLSState.ServerName,
+			HandshakeComplete:  r.TLSState.HandshakeComplete,
+			DidResume:          r.TLSState.DidResume,
+			NegotiatedProtocol: r.TLSState.NegotiatedProtocol,
+			Certificates:       []certificateJSON{},
+		}
+		for _, cert := range r.CertificateDetails() {
+			c := certificateJSON{
+				CommonName:         cert.CommonName,
+				Issuer:             cert.Issuer,
+				NotBefore:          cert.NotBefore,
+				NotAfter:           cert.NotAfter,
+				PublicKeyAlgorithm: cert.PublicKeyAlgorithm.String(),
+				SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+				DNSNames:           cert.DNSNames,
+				IPAddresses:        make([]string, len(cert.IPAddresses)),
+				URIs:               make([]string, len(cert.URIs)),
+			}
+			for i, ip := range cert.IPAddresses {
+				c.IPAddresses[i] = ip.String()
+			}
+			for i, u := range cert.URIs {
+				c.URIs[i] = u.String()
+			}
+			out.TLS.Certificates = append(out.TLS.Certificates, c)
+		}
+		if cr := r.CertificateReport; cr != nil {
+			report := certReportJSON(*cr)
+			out.TLS.Report = &report
+		}
+	}
+
+	for _, ext := range r.Extensions {
+		out.Extensions = append(out.Extensions, extensionJSON(ext))
+	}
+	if r.HandshakeTCPInfo != nil || r.MessageTCPInfo != nil {
+		out.TCPInfo = &tcpInfosJSON{newTCPInfoJSON(r.HandshakeTCPInfo), newTCPInfoJSON(r.MessageTCPInfo)}
+	}
+	if w := r.Wire; w.WSUpgrade.Written > 0 {
+		out.Wire = &wireJSON{
+			Proxy:     byteCountJSON(w.Proxy),
+			TLS:       byteCountJSON(w.TLS),
+			WSUpgrade: byteCountJSON(w.WSUpgrade),
+			Messages:  byteCountJSON(w.Messages),
+			Close:     byteCountJSON(w.Close),
+			Sent:      make(map[string]frameCountJSON, len(w.Sent)),
+			Received:  make(map[string]frameCountJSON, len(w.Received)),
+		}
+		for messageType, fc := range w.Sent {
+			out.Wire.Sent[messageType] = frameCountJSON(fc)
+		}
+		for messageType, fc := range w.Received {
+			out.Wire.Received[messageType] = frameCountJSON(fc)
+		}
+	}
+	if ca := r.ClientAuth; ca != nil {
+		clientAuth := clientAuthJSON(*ca)
+		out.ClientAuth = &clientAuth
+	}
+	out.SkippedMessages = r.SkippedMessages
+	for _, m := range r.Skipped {
+		skipped := skippedJSON{Type: messageTypeName(m.Type), Received: jsonutil.Duration(m.Received)}
+		if m.Type == websocket.TextMessage {
+			skipped.Text = string(m.Data)
+		} else {
+			skipped.Binary = m.Data
+		}
+		out.Skipped = append(out.Skipped, skipped)
+	}
+
+	if r.Stats != nil {
+		out.Stats = &statsJSON{
+			Samples: make([]jsonutil.Duration, len(r.Stats.Samples)),
+			Min:     jsonutil.Duration(r.Stats.Min),
+			Max:     jsonutil.Duration(r.Stats.Max),
+			Mean:    jsonutil.Duration(r.Stats.Mean),
+			StdDev:  jsonutil.Duration(r.Stats.StdDev),
+			P50:     jsonutil.Duration(r.Stats.P50),
+			P90:     jsonutil.Duration(r.Stats.P90),
+			P99:     jsonutil.Duration(r.Stats.P99),
+			Jitter:  jsonutil.Duration(r.Stats.Jitter),
+		}
+		for i, d := range r.Stats.Samples {
+			out.Stats.Samples[i] = jsonutil.Duration(d)
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a Result encoded by MarshalJSON.
+// The TLS state is restored from its names; the peer certificates themselves are not
+// available, but CertificateDetails returns the decoded details.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var in resultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*r = Result{
+		IPs:             in.IPs,
+		RemoteAddr:      in.RemoteAddr,
+		Transport:       in.Transport,
+		RequestHeaders:  in.RequestHeaders,
+		ResponseHeaders: in.ResponseHeaders,
+		StatusCode:      in.StatusCode,
+		Subprotocol:     in.Subprotocol,
+	}
+	if in.Start != nil {
+		r.Start = *in.Start
+	}
+	u, err := url.Parse(in.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	r.URL = *u
+	if in.FailedPhase != nil {
+		r.FailedPhase = *in.FailedPhase
+	}
+	if in.DNS != nil {
+		r.DNS = &DNSAnswer{
+			Resolver: in.DNS.Resolver,
+			Addrs:    make([]DNSAddr, len(in.DNS.Addrs)),
+			CNAMEs:   in.DNS.CNAMEs,
+		}
+		for i, a := range in.DNS.Addrs {
+			r.DNS.Addrs[i].IP = net.ParseIP(a.IP)
+			if a.TTL != nil {
+				r.DNS.Addrs[i].TTL = time.Duration(*a.TTL)
+			}
+		}
+	}
+	if in.FamilyRace != nil {
+		r.FamilyRace = &FamilyRace{
+			Winner:        in.FamilyRace.Winner,
+			Loser:         in.FamilyRace.Loser,
+			LoserDuration: time.Duration(in.FamilyRace.LoserDuration),
+		}
+		switch in.FamilyRace.LoserError {
+		case "":
+		case ErrRaceLost.Error():
+			r.FamilyRace.LoserErr = ErrRaceLost
+		default:
+			r.FamilyRace.LoserErr = errors.New(in.FamilyRace.LoserError)
+		}
+	}
+	for _, d := range r.durations() {
+		*d.value = time.Duration(in.Durations[d.key])
+	}
+
+	if in.TLS != nil {
+		r.TLSState = &tls.ConnectionState{
+			Version:            tlsVersion(in.TLS.Version),
+			CipherSuite:        cipherSuite(in.TLS.CipherSuite),
+			ServerName:         in.TLS.ServerName,
+			HandshakeComplete:  in.TLS.HandshakeComplete,
+			DidResume:          in.TLS.DidResume,
+			NegotiatedProtocol: in.TLS.NegotiatedProtocol,
+		}
+		r.certificates = []CertificateDetails{}
+		for _, c := range in.TLS.Certificates {
+			cert := CertificateDetails{
+				CommonName:         c.CommonName,
+				Issuer:             c.Issuer,
+				NotBefore:          c.NotBefore,
+				NotAfter:           c.NotAfter,
+				PublicKeyAlgorithm: publicKeyAlgorithm(c.PublicKeyAlgorithm),
+				SignatureAlgorithm: signatureAlgorithm(c.SignatureAlgorithm),
+				DNSNames:           c.DNSNames,
+			}
+			for _, ip := range c.IPAddresses {
+				cert.IPAddresses = append(cert.IPAddresses, net.ParseIP(ip))
+			}
+			for _, raw := range c.URIs {
+				if u, err := url.Parse(raw); err == nil {
+					cert.URIs = append(cert.URIs, u)
+				}
+			}
+			r.certificates = append(r.certificates, cert)
+		}
+		if in.TLS.Report != nil {
+			report := CertificateReport(*in.TLS.Report)
+			r.CertificateReport = &report
+		}
+	}
+
+	for _, ext := range in.Extensions {
+		r.Extensions = append(r.Extensions, Extension(ext))
+	}
+	r.SkippedMessages = in.SkippedMessages
+	for _, m := range in.Skipped {
+		skipped := SkippedMessage{Type: websocket.BinaryMessage, Data: m.Binary, Received: time.Duration(m.Received)}
+		if m.Type == messageTypeName(websocket.TextMessage) {
+			skipped.Type = websocket.TextMessage
+			skipped.Data = []byte(m.Text)
+		}
+		r.Skipped = append(r.Skipped, skipped)
+	}
+	if in.TCPInfo != nil {
+		r.HandshakeTCPInfo = in.TCPInfo.Handshake.tcpInfo()
+		r.MessageTCPInfo = in.TCPInfo.Message.tcpInfo()
+	}
+	if w := in.Wire; w != nil {
+		r.Wire = WireStats{
+			Proxy:     ByteCount(w.Proxy),
+			TLS:       ByteCount(w.TLS),
+			WSUpgrade: ByteCount(w.WSUpgrade),
+			Messages:  ByteCount(w.Messages),
+			Close:     ByteCount(w.Close),
+		}
+		for messageType, fc := range w.Sent {
+			if r.Wire.Sent == nil {
+				r.Wire.Sent = map[string]FrameCount{}
+			}
+			r.Wire.Sent[messageType] = FrameCount(fc)
+		}
+		for messageType, fc := range w.Received {
+			if r.Wire.Received == nil {
+				r.Wire.Received = map[string]FrameCount{}
+			}
+			r.Wire.Received[messageType] = FrameCount(fc)
+		}
+	}
+	if in.ClientAuth != nil {
+		clientAuth := ClientAuth(*in.ClientAuth)
+		r.ClientAuth = &clientAuth
+	}
+
+	if in.Stats != nil {
+		r.Stats = &LatencyStats{
+			Samples: make([]time.Duration, len(in.Stats.Samples)),
+			Min:     time.Duration(in.Stats.Min),
+			Max:     time.Duration(in.Stats.Max),
+			Mean:    time.Duration(in.Stats.Mean),
+			StdDev:  time.Duration(in.Stats.StdDev),
+			P50:     time.Duration(in.Stats.P50),
+			P90:     time.Duration(in.Stats.P90),
+			P99:     time.Duration(in.Stats.P99),
+			Jitter:  time.Duration(in.Stats.Jitter),
+		}
+		for i, d := range in.Stats.Samples {
+			r.Stats.Samples[i] = time.Duration(d)
+		}
+	}
+
+	return nil
+}
+
+// resumptionJSON is the JSON representation of Resumption.
+type resumptionJSON struct {
+	Initial   Result            `json:"initial"`
+	Resumed   Result            `json:"resumed"`
+	DidResume bool              `json:"did_resume"`
+	Saving    jsonutil.Duration `json:"saving"`
+}
+
+// MarshalJSON encodes the Resumption with both results and the saving as a duration object.
+func (r Resumption) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resumptionJSON{r.Initial, r.Resumed, r.DidResume, jsonutil.Duration(r.Saving)})
+}
+
+// UnmarshalJSON decodes a Resumption encoded by MarshalJSON.
+func (r *Resumption) UnmarshalJSON(data []byte) error {
+	var in resumptionJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*r = Resumption{in.Initial, in.Resumed, in.DidResume, time.Duration(in.Saving)}
+	return nil
+}
+
+// compressionRunJSON is the JSON representation of CompressionRun.
+type compressionRunJSON struct {
+	Result       Result  `json:"result"`
+	PayloadBytes int64   `json:"payload_bytes"`
+	WireBytes    int64   `json:"wire_bytes"`
+	Ratio        float64 `json:"ratio"`
+}
+
+// compressionJSON is the JSON representation of CompressionReport.
+type compressionJSON struct {
+	Plain             compressionRunJSON `json:"plain"`
+	Compressed        compressionRunJSON `json:"compressed"`
+	Negotiated        bool               `json:"negotiated"`
+	Ratio             float64            `json:"ratio"`
+	LatencyDifference jsonutil.Duration  `json:"latency_difference"`
+}
+
+// MarshalJSON encodes the CompressionReport with the wire to payload ratio of each run.
+func (r CompressionReport) MarshalJSON() ([]byte, error) {
+	run := func(r CompressionRun) compressionRunJSON {
+		return compressionRunJSON{r.Result, r.PayloadBytes, r.WireBytes, r.Ratio()}
+	}
+	return json.Marshal(compressionJSON{run(r.Plain), run(r.Compressed), r.Negotiated, r.Ratio, jsonutil.Duration(r.LatencyDifference)})
+}
+
+// UnmarshalJSON decodes a CompressionReport encoded by MarshalJSON.
+func (r *CompressionReport) UnmarshalJSON(data []byte) error {
+	var in compressionJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	run := func(in compressionRunJSON) CompressionRun {
+		return CompressionRun{in.Result, in.PayloadBytes, in.WireBytes}
+	}
+	*r = CompressionReport{run(in.Plain), run(in.Compressed), in.Negotiated, in.Ratio, time.Duration(in.LatencyDifference)}
+	return nil
+}
+
+// tlsVersion returns the TLS version with the given name, or 0 if unknown.
+func tlsVersion(name string) uint16 {
+	for _, v := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		if tls.VersionName(v) == name {
+			return v
+		}
+	}
+	return 0
+}
+
+// cipherSuite returns the ID of the cipher suite with the given name, or 0 if unknown.
+func cipherSuite(name string) uint16 {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name == name {
+				return suite.ID
+			}
+		}
+	}
+	return 0
+}
+
+// publicKeyAlgorithm returns the public key algorithm with the given name,
+// or x509.UnknownPublicKeyAlgorithm if unknown.
+func publicKeyAlgorithm(name string) x509.PublicKeyAlgorithm {
+	for _, alg := range []x509.PublicKeyAlgorithm{x509.RSA, x509.DSA, x509.ECDSA, x509.Ed25519} {
+		if alg.String() == name {
+			return alg
+		}
+	}
+	return x509.UnknownPublicKeyAlgorithm
+}
+
+// signatureAlgorithm returns the signature algorithm with the given name,
+// or x509.UnknownSignatureAlgorithm if unknown.
+func signatureAlgorithm(name string) x509.SignatureAlgorithm {
+	for alg := x509.MD2WithRSA; alg <= x509.PureEd25519; alg++ {
+		if alg.String() == name {
+			return alg
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
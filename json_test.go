@@ -0,0 +1,110 @@
+package wsstat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+func TestResultJSON(t *testing.T) {
+	server, tlsConfig := wstest.StartTLSEchoServer(t)
+	sampler := Sampler{Count: 3, MessageType: websocket.TextMessage, Payload: []byte("Hello, world!")}
+	result, err := MeasureLatencyN(wsURL(t, server, "/echo"), sampler, http.Header{}, WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	for _, key := range []string{`"url"`, `"ips"`, `"remote_addr"`, `"durations"`, `"dns_lookup"`, `"tls_handshake"`,
+		`"total_time"`, `"ns"`, `"ms"`, `"tls"`, `"cipher_suite"`, `"certificates"`, `"common_name"`,
+		`"request_headers"`, `"response_headers"`, `"stats"`, `"p99"`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("Expected key %s in %s", key, data)
+		}
+	}
+	if strings.Contains(string(data), `"failed_phase"`) {
+		t.Errorf("Did not expect failed_phase for successful result: %s", data)
+	}
+
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.URL.String() != result.URL.String() {
+		t.Errorf("Unexpected URL: %s", decoded.URL.String())
+	}
+	if decoded.RemoteAddr != result.RemoteAddr {
+		t.Errorf("Unexpected remote address: %s", decoded.RemoteAddr)
+	}
+	for i, d := range decoded.durations() {
+		if *d.value != *result.durations()[i].value {
+			t.Errorf("Unexpected %s: %v, expected %v", d.name, *d.value, *result.durations()[i].value)
+		}
+	}
+	if decoded.TLSState.Version != result.TLSState.Version || decoded.TLSState.CipherSuite != result.TLSState.CipherSuite {
+		t.Errorf("Unexpected TLS state: %+v", decoded.TLSState)
+	}
+	if !reflect.DeepEqual(decoded.Stats, result.Stats) {
+		t.Errorf("Unexpected stats: %+v, expected %+v", decoded.Stats, result.Stats)
+	}
+
+	decodedCerts, certs := decoded.CertificateDetails(), result.CertificateDetails()
+	if len(decodedCerts) != len(certs) {
+		t.Fatalf("Expected %d certificates, got %d", len(certs), len(decodedCerts))
+	}
+	for i := range certs {
+		if decodedCerts[i].CommonName != certs[i].CommonName ||
+			decodedCerts[i].PublicKeyAlgorithm != certs[i].PublicKeyAlgorithm ||
+			decodedCerts[i].SignatureAlgorithm != certs[i].SignatureAlgorithm ||
+			!decodedCerts[i].NotAfter.Equal(certs[i].NotAfter) ||
+			len(decodedCerts[i].IPAddresses) != len(certs[i].IPAddresses) {
+			t.Errorf("Unexpected certificate details: %+v, expected %+v", decodedCerts[i], certs[i])
+		}
+	}
+}
+
+func TestResultJSONFailedPhase(t *testing.T) {
+	result := Result{FailedPhase: PhaseTLS, DNSLookup: 40 * time.Millisecond}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	if !strings.Contains(string(data), `"failed_phase":"tls"`) {
+		t.Errorf("Expected failed phase in %s", data)
+	}
+	if !strings.Contains(string(data), `"dns_lookup":{"ns":40000000,"ms":40}`) {
+		t.Errorf("Expected DNS lookup duration in %s", data)
+	}
+
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.FailedPhase != PhaseTLS || decoded.DNSLookup != 40*time.Millisecond {
+		t.Errorf("Unexpected decoded result: %+v", decoded)
+	}
+}
+
+func TestResultFormatStableOrder(t *testing.T) {
+	result := Result{DNSLookup: time.Millisecond, TotalTime: time.Second, ConnectionClose: time.Millisecond}
+	first := fmt.Sprintf("%s", result)
+	for i := 0; i < 10; i++ {
+		if got := fmt.Sprintf("%s", result); got != first {
+			t.Fatalf("Unstable output: %q vs %q", got, first)
+		}
+	}
+	if !strings.HasPrefix(first, "DNSLookup: 1 ms, TCPConnection: 0 ms") {
+		t.Errorf("Unexpected order: %s", first)
+	}
+}
@@ -0,0 +1,376 @@
+// Package jsonrpc probes JSON-RPC 2.0 servers over WebSocket with wsstat, such as Ethereum nodes.
+//
+// The probe assigns an ID to each request and times the response with that ID, skipping
+// notifications and other responses, see wsstat.WithMatcher. An error object in the response
+// fails the probe in the read phase with an *Error, classified by its code. For subscription
+// methods such as eth_subscribe, the probe also times the first notification of the
+// subscription, and ends the subscription before closing the connection.
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/relaytools/go-wsstat"
+	"github.com/relaytools/go-wsstat/internal/jsonutil"
+)
+
+// Version is the JSON-RPC version of the requests.
+const Version = "2.0"
+
+// Probe describes the call of a probe.
+type Probe struct {
+	Method string // Method to call, such as "eth_blockNumber" or "eth_subscribe"
+	Params any    // Parameters of the call, omitted if nil
+
+	// Subscribe waits for the first notification of the subscription the call returns.
+	Subscribe bool
+	// NotificationTimeout is how long to wait for the first notification, DefaultNotificationTimeout
+	// if zero. It replaces the read timeout set with wsstat.WithReadTimeout for this wait only, as
+	// notifications can be much further apart than responses.
+	NotificationTimeout time.Duration
+	// Unsubscribe is the method ending the subscription, called with the subscription ID before
+	// closing. It defaults to Method with "subscribe" replaced by "unsubscribe", such as eth_unsubscribe.
+	Unsubscribe string
+}
+
+// DefaultNotificationTimeout is the default Probe.NotificationTimeout, longer than the interval of
+// the newHeads notifications of Ethereum, a block about every 12s.
+const DefaultNotificationTimeout = time.Minute
+
+// notificationTimeout returns how long to wait for the first notification of the subscription.
+func (p Probe) notificationTimeout() time.Duration {
+	if p.NotificationTimeout > 0 {
+		return p.NotificationTimeout
+	}
+	return DefaultNotificationTimeout
+}
+
+// unsubscribeMethod returns the method ending the subscription of the probe.
+func (p Probe) unsubscribeMethod() string {
+	if p.Unsubscribe != "" {
+		return p.Unsubscribe
+	}
+	return strings.Replace(p.Method, "subscribe", "unsubscribe", 1)
+}
+
+// Result holds the timings of a probe: those of the connection, in the embedded wsstat.Result,
+// followed by those of the call. The MessageRoundTrip of the embedded result is the time to the
+// response of the call, which for subscriptions is the confirmation of the subscription.
+type Result struct {
+	wsstat.Result
+
+	ID       int64           // ID of the request of the call
+	Response json.RawMessage // Result member of the response, nil if the call failed
+	Error    *Error          // Error object of the response, if the call failed
+
+	Subscription      string          // ID of the subscription, if the probe subscribed
+	FirstNotification time.Duration   // Time from the subscription request to its first notification
+	Notification      json.RawMessage // Result member of the first notification
+	Unsubscribed      bool            // Whether the server confirmed the end of the subscription
+}
+
+// Error is the error object of a JSON-RPC response.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Classes of errors, see Error.Class.
+const (
+	ClassParseError     = "parse_error"
+	ClassInvalidRequest = "invalid_request"
+	ClassMethodNotFound = "method_not_found"
+	ClassInvalidParams  = "invalid_params"
+	ClassInternalError  = "internal_error"
+	ClassServerError    = "server_error"
+	ClassApplication    = "application_error"
+)
+
+// Class classifies the error by its code: the codes defined by the JSON-RPC 2.0 specification,
+// the range reserved for server errors (-32099 to -32000), and other codes defined by the
+// application.
+func (e *Error) Class() string {
+	switch {
+	case e.Code == -32700:
+		return ClassParseError
+	case e.Code == -32600:
+		return ClassInvalidRequest
+	case e.Code == -32601:
+		return ClassMethodNotFound
+	case e.Code == -32602:
+		return ClassInvalidParams
+	case e.Code == -32603:
+		return ClassInternalError
+	case e.Code >= -32099 && e.Code <= -32000:
+		return ClassServerError
+	default:
+		return ClassApplication
+	}
+}
+
+// Error returns the class, code and message of the error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC %s %d: %s", e.Class(), e.Code, e.Message)
+}
+
+// ErrInvalidResponse is returned when the response to a call has neither a result nor an error.
+var ErrInvalidResponse = errors.New("response has neither a result nor an error")
+
+// request is a JSON-RPC request.
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int64  `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response, or a notification if it has a method.
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+	Method string          `json:"method"`
+	Params struct {
+		Subscription json.RawMessage `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// client assigns the IDs of the requests of a connection, and identifies the messages it waits for.
+type client struct {
+	ws     *wsstat.WSStat
+	nextID int64
+
+	mu      sync.Mutex
+	want    wsstat.Matcher // Matcher of the message waited for
+	matched []byte         // Last message accepted by want
+
+	failed bool // Whether a response failed the probe, leaving the connection usable
+}
+
+// match is the matcher of the connection, accepting the messages accepted by c.want.
+// It keeps the message accepted, as the message returned by SendMessageJSON is decoded
+// into an interface{}, which loses the precision of large numbers.
+func (c *client) match(messageType int, data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.want == nil || !c.want(messageType, data) {
+		return false
+	}
+	c.matched = data
+	return true
+}
+
+// expect sets the matcher of the message to wait for.
+func (c *client) expect(m wsstat.Matcher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.want = m
+	c.matched = nil
+}
+
+// lastMatched returns the last message accepted by the matcher.
+func (c *client) lastMatched() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.matched
+}
+
+// fail attributes an error of a response to the read phase. Unlike the errors of wsstat, the
+// connection is still usable and is closed normally.
+func (c *client) fail(err error) error {
+	c.failed = true
+	c.ws.Result.FailedPhase = wsstat.PhaseRead
+	return &wsstat.PhaseError{Phase: wsstat.PhaseRead, Err: err}
+}
+
+// call sends a request and returns its ID and the response with the same ID.
+// An error object in the response is returned as an *Error, in the read phase.
+func (c *client) call(ctx context.Context, method string, params any) (int64, *response, error) {
+	c.nextID++
+	id := c.nextID
+	c.expect(wsstat.MatchJSONPath("id", id))
+	if _, err := c.ws.SendMessageJSONContext(ctx, request{Version, id, method, params}); err != nil {
+		return id, nil, err
+	}
+	var resp response
+	if err := json.Unmarshal(c.lastMatched(), &resp); err != nil {
+		return id, nil, c.fail(err)
+	}
+	if resp.Error != nil {
+		return id, &resp, c.fail(resp.Error)
+	}
+	if resp.Result == nil {
+		return id, &resp, c.fail(ErrInvalidResponse)
+	}
+	return id, &resp, nil
+}
+
+// Measure connects to the server at url, calls the method of the probe and closes the connection.
+// A failed call returns an *Error in the read phase, with the connection closed normally. On
+// failure the result holds the timings of the exchanges that completed.
+func Measure(ctx context.Context, url *url.URL, p Probe, opts ...wsstat.Option) (Result, error) {
+	var r Result
+	c := &client{}
+	c.ws = wsstat.NewWSStat(append(opts[:len(opts):len(opts)], wsstat.WithMatcher(c.match))...)
+	if err := c.ws.DialContext(ctx, url, nil); err != nil {
+		r.Result = *c.ws.Result
+		return r, err
+	}
+	err := r.run(ctx, c, p)
+	if wsstat.ErrorPhase(err) != wsstat.PhaseNone && !c.failed {
+		c.ws.Abort()
+	} else if closeErr := c.ws.CloseConnContext(ctx); err == nil {
+		err = closeErr
+	}
+	r.Result = *c.ws.Result
+	return r, err
+}
+
+// run calls the method, and for subscriptions waits for the first notification and unsubscribes.
+func (r *Result) run(ctx context.Context, c *client, p Probe) error {
+	start := time.Now()
+	id, resp, err := c.call(ctx, p.Method, p.Params)
+	r.ID = id
+	if resp != nil {
+		r.Response, r.Error = resp.Result, resp.Error
+	}
+	if err != nil || !p.Subscribe {
+		return err
+	}
+	if err := json.Unmarshal(resp.Result, &r.Subscription); err != nil {
+		return c.fail(fmt.Errorf("invalid subscription ID %s: %w", resp.Result, err))
+	}
+
+	// Each read sets the message round trip, which is reset to the confirmation
+	confirmation := c.ws.Result.MessageRoundTrip
+	defer func() {
+		c.ws.Result.MessageRoundTrip = confirmation
+		c.ws.Result.FirstMessageResponse = c.ws.Result.WSHandshakeDone + confirmation
+	}()
+
+	c.expect(wsstat.MatchJSONPath("params.subscription", r.Subscription))
+	if _, _, err := c.ws.ReadMessageTimeout(ctx, start, p.notificationTimeout()); err != nil {
+		return err
+	}
+	r.FirstNotification = time.Since(start)
+	var notification response
+	if err := json.Unmarshal(c.lastMatched(), &notification); err != nil {
+		return c.fail(err)
+	}
+	r.Notification = notification.Params.Result
+
+	_, resp, err = c.call(ctx, p.unsubscribeMethod(), []string{r.Subscription})
+	if err != nil {
+		return err
+	}
+	json.Unmarshal(resp.Result, &r.Unsubscribed)
+	return nil
+}
+
+// Format formats the result like wsstat.Result, followed by the call.
+func (r Result) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v", r.Result)
+			fmt.Fprintf(s, "\nJSON-RPC\n")
+			fmt.Fprintf(s, "  Request ID: %d\n", r.ID)
+			if r.Error != nil {
+				fmt.Fprintf(s, "  Error: %v\n", r.Error)
+			} else if r.Response != nil {
+				fmt.Fprintf(s, "  Result: %s\n", r.Response)
+			}
+			if r.Subscription != "" {
+				fmt.Fprintf(s, "  Subscription: %s\n", r.Subscription)
+				fmt.Fprintf(s, "  Confirmation:       %4d ms\n", int(r.MessageRoundTrip/time.Millisecond))
+				if r.Notification != nil {
+					fmt.Fprintf(s, "  First notification: %4d ms\n", int(r.FirstNotification/time.Millisecond))
+				}
+				fmt.Fprintf(s, "  Unsubscribed: %t\n", r.Unsubscribed)
+			}
+			return
+		}
+
+		fallthrough
+	case 's', 'q':
+		fmt.Fprintf(s, "%s, FirstNotification: %d ms", r.Result, r.FirstNotification/time.Millisecond)
+	}
+}
+
+// callJSON is the JSON representation of the call of Result.
+type callJSON struct {
+	ID                int64             `json:"id"`
+	Result            json.RawMessage   `json:"result,omitempty"`
+	Error             *errorJSON        `json:"error,omitempty"`
+	Subscription      string            `json:"subscription,omitempty"`
+	FirstNotification jsonutil.Duration `json:"first_notification,omitempty"`
+	Notification      json.RawMessage   `json:"notification,omitempty"`
+	Unsubscribed      bool              `json:"unsubscribed,omitempty"`
+}
+
+// errorJSON is the JSON representation of Error, with its class.
+type errorJSON struct {
+	Error
+	Class string `json:"class"`
+}
+
+// MarshalJSON encodes the result as wsstat.Result does, with the call under "jsonrpc".
+func (r Result) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	call := callJSON{
+		ID:                r.ID,
+		Result:            r.Response,
+		Subscription:      r.Subscription,
+		FirstNotification: jsonutil.Duration(r.FirstNotification),
+		Notification:      r.Notification,
+		Unsubscribed:      r.Unsubscribed,
+	}
+	if r.Error != nil {
+		call.Error = &errorJSON{*r.Error, r.Error.Class()}
+	}
+	if out["jsonrpc"], err = json.Marshal(call); err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Result); err != nil {
+		return err
+	}
+	var in struct {
+		Call callJSON `json:"jsonrpc"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	call := in.Call
+	r.ID = call.ID
+	r.Response = call.Result
+	r.Error = nil
+	if call.Error != nil {
+		r.Error = &call.Error.Error
+	}
+	r.Subscription = call.Subscription
+	r.FirstNotification = time.Duration(call.FirstNotification)
+	r.Notification = call.Notification
+	r.Unsubscribed = call.Unsubscribed
+	return nil
+}
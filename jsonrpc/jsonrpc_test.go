@@ -0,0 +1,196 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat"
+)
+
+// startNode starts a JSON-RPC server answering eth_blockNumber, eth_subscribe and eth_unsubscribe,
+// which pushes a notification of another subscription before each response. The notification of
+// a subscription to "slowHeads" is sent after 300ms, and the confirmation of a subscription to
+// "slowConfirm" after 300ms.
+func startNode(t *testing.T) *url.URL {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		notify := func(sub string, result any) {
+			conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "method": "eth_subscription",
+				"params": map[string]any{"subscription": sub, "result": result}})
+		}
+		for {
+			var req request
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			notify("0xother", "0x0")
+			if fmt.Sprint(req.Params) == "[slowConfirm]" {
+				time.Sleep(300 * time.Millisecond)
+			}
+			resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+			switch req.Method {
+			case "eth_blockNumber":
+				resp["result"] = "0x10"
+			case "eth_subscribe":
+				resp["result"] = "0xsub"
+			case "eth_unsubscribe":
+				resp["result"] = fmt.Sprint(req.Params) == "[0xsub]"
+			case "eth_empty":
+			default:
+				resp["error"] = map[string]any{"code": -32601, "message": "the method " + req.Method + " does not exist"}
+			}
+			conn.WriteJSON(resp)
+			if req.Method == "eth_subscribe" {
+				if fmt.Sprint(req.Params) == "[slowHeads]" {
+					time.Sleep(300 * time.Millisecond)
+				}
+				notify("0xsub", map[string]any{"number": "0x11"})
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse("ws" + strings.TrimPrefix(server.URL, "http"))
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	return u
+}
+
+func TestMeasure(t *testing.T) {
+	u := startNode(t)
+	result, err := Measure(context.Background(), u, Probe{Method: "eth_blockNumber"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ID != 1 || string(result.Response) != `"0x10"` || result.Error != nil {
+		t.Errorf("Unexpected response %d: %s", result.ID, result.Response)
+	}
+	// The notification of the other subscription is not the response
+	if result.SkippedMessages != 1 || result.MessageRoundTrip <= 0 || result.TotalTime <= 0 {
+		t.Errorf("Unexpected connection timings, %d skipped: %v", result.SkippedMessages, result.Result)
+	}
+}
+
+func TestMeasureSubscription(t *testing.T) {
+	u := startNode(t)
+	result, err := Measure(context.Background(), u, Probe{Method: "eth_subscribe", Params: []string{"newHeads"}, Subscribe: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Subscription != "0xsub" || string(result.Notification) != `{"number":"0x11"}` || !result.Unsubscribed {
+		t.Errorf("Unexpected subscription %q: notification %s, unsubscribed %t", result.Subscription, result.Notification, result.Unsubscribed)
+	}
+	if result.MessageRoundTrip <= 0 || result.FirstNotification < result.MessageRoundTrip {
+		t.Errorf("Expected the notification after the confirmation, got %v and %v", result.FirstNotification, result.MessageRoundTrip)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "Subscription: 0xsub") || !strings.Contains(out, "Unsubscribed: true") {
+		t.Errorf("Expected the subscription in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.Subscription != "0xsub" || decoded.FirstNotification != result.FirstNotification ||
+		string(decoded.Notification) != string(result.Notification) || decoded.MessageRoundTrip != result.MessageRoundTrip {
+		t.Errorf("Unexpected decoded result: %s", data)
+	}
+}
+
+func TestMeasureNotificationTimeout(t *testing.T) {
+	u := startNode(t)
+	probe := Probe{Method: "eth_subscribe", Params: []string{"slowHeads"}, Subscribe: true}
+
+	// The read timeout does not apply to the wait for the notification
+	result, err := Measure(context.Background(), u, probe, wsstat.WithReadTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.FirstNotification < 300*time.Millisecond {
+		t.Errorf("Expected the notification after 300ms, got %v", result.FirstNotification)
+	}
+
+	probe.NotificationTimeout = 100 * time.Millisecond
+	result, err = Measure(context.Background(), u, probe)
+	if wsstat.ErrorPhase(err) != wsstat.PhaseRead || result.Subscription != "0xsub" || result.Notification != nil {
+		t.Errorf("Expected a read phase error waiting for the notification, got %v", err)
+	}
+
+	// The read timeout still bounds the confirmation of the subscription
+	probe = Probe{Method: "eth_subscribe", Params: []string{"slowConfirm"}, Subscribe: true}
+	result, err = Measure(context.Background(), u, probe, wsstat.WithReadTimeout(100*time.Millisecond))
+	if wsstat.ErrorPhase(err) != wsstat.PhaseRead || result.Subscription != "" {
+		t.Errorf("Expected a read phase error waiting for the confirmation, got %v", err)
+	}
+}
+
+func TestMeasureError(t *testing.T) {
+	u := startNode(t)
+	result, err := Measure(context.Background(), u, Probe{Method: "eth_missing"})
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Class() != ClassMethodNotFound || wsstat.ErrorPhase(err) != wsstat.PhaseRead {
+		t.Fatalf("Expected a method not found error in the read phase, got %v", err)
+	}
+	// The connection is closed normally after an error object
+	if result.Error == nil || result.Error.Code != -32601 || result.FailedPhase != wsstat.PhaseRead || result.TotalTime <= 0 {
+		t.Errorf("Unexpected result: %+v", result.Error)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	if !strings.Contains(string(data), `"class":"method_not_found"`) {
+		t.Errorf("Expected the error class in the JSON: %s", data)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Error == nil || decoded.Error.Code != -32601 {
+		t.Errorf("Unexpected decoded error: %v", err)
+	}
+
+	if _, err := Measure(context.Background(), u, Probe{Method: "eth_empty"}); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Expected ErrInvalidResponse, got %v", err)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{-32700, ClassParseError},
+		{-32600, ClassInvalidRequest},
+		{-32601, ClassMethodNotFound},
+		{-32602, ClassInvalidParams},
+		{-32603, ClassInternalError},
+		{-32000, ClassServerError},
+		{-32099, ClassServerError},
+		{-32100, ClassApplication},
+		{3, ClassApplication},
+	}
+	for _, tt := range tests {
+		if got := (&Error{Code: tt.code}).Class(); got != tt.want {
+			t.Errorf("Expected class %s for code %d, got %s", tt.want, tt.code, got)
+		}
+	}
+}
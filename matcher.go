@@ -0,0 +1,115 @@
+package wsstat
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Matcher reports whether a received message is the response to the message sent, see WithMatcher.
+// messageType is websocket.TextMessage or websocket.BinaryMessage.
+type Matcher func(messageType int, data []byte) bool
+
+// SkippedMessage is a message received while waiting for the response, that the matcher did not accept.
+type SkippedMessage struct {
+	Type     int           // websocket.TextMessage or websocket.BinaryMessage
+	Data     []byte        // Payload of the message
+	Received time.Duration // Time from sending the message to receiving this one
+}
+
+// MatchRegexp returns a Matcher accepting the messages that re matches.
+func MatchRegexp(re *regexp.Regexp) Matcher {
+	return func(_ int, data []byte) bool {
+		return re.Match(data)
+	}
+}
+
+// MatchJSONPath returns a Matcher accepting the JSON messages holding value at path. path is a
+// dot-separated list of object keys and array indices, such as "id" or "params.subscription"
+// or "0" for the first element of an array. Values are compared in their JSON form, so
+// MatchJSONPath("id", 1) accepts {"id": 1.0}.
+func MatchJSONPath(path string, value any) Matcher {
+	want, err := normalizeJSON(value)
+	return func(_ int, data []byte) bool {
+		if err != nil {
+			return false
+		}
+		var v any
+		if json.Unmarshal(data, &v) != nil {
+			return false
+		}
+		got, ok := lookupJSONPath(v, path)
+		return ok && reflect.DeepEqual(got, want)
+	}
+}
+
+// normalizeJSON returns value as decoded from its JSON encoding, for comparison with decoded messages.
+func normalizeJSON(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// lookupJSONPath returns the value at path in the decoded JSON value v, see MatchJSONPath.
+func lookupJSONPath(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// readResponse reads messages until the matcher of the instance accepts one, or reads a single
+// message without a matcher. The messages skipped are counted, and captured up to the limit set
+// with WithCaptureSkipped.
+// Sets result fields: SkippedMessages, Skipped
+func (ws *WSStat) readResponse(writeStart time.Time) (int, []byte, error) {
+	for {
+		msgType, p, err := ws.conn.ReadMessage()
+		if err != nil || ws.cfg.matcher == nil || ws.cfg.matcher(msgType, p) {
+			return msgType, p, err
+		}
+		ws.Result.SkippedMessages++
+		if len(ws.Result.Skipped) < ws.cfg.captureSkipped {
+			ws.Result.Skipped = append(ws.Result.Skipped, SkippedMessage{msgType, p, time.Since(writeStart)})
+		}
+	}
+}
+
+// messageTypeName returns the name of a data message type, as used in WireStats.
+func messageTypeName(messageType int) string {
+	switch messageType {
+	case websocket.TextMessage:
+		return "text"
+	case websocket.BinaryMessage:
+		return "binary"
+	default:
+		return strconv.Itoa(messageType)
+	}
+}
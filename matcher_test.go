@@ -0,0 +1,117 @@
+package wsstat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// startChattyServer starts a server that sends a heartbeat and a binary broadcast before
+// echoing each message.
+func startChattyServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"heartbeat"}`))
+			conn.WriteMessage(websocket.BinaryMessage, []byte{1, 2, 3})
+			if err := conn.WriteMessage(mt, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMatcher(t *testing.T) {
+	server := startChattyServer(t)
+	url := wsURL(t, server, "/")
+
+	result, response, err := MeasureLatencyContext(context.Background(), url, `{"id":7,"method":"status"}`, http.Header{},
+		WithMatcher(MatchJSONPath("id", 7)), WithCaptureSkipped(1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(response) != `{"id":7,"method":"status"}` {
+		t.Errorf("Unexpected response: %s", response)
+	}
+	if result.SkippedMessages != 2 || len(result.Skipped) != 1 {
+		t.Fatalf("Expected 2 skipped messages with 1 captured, got %d: %+v", result.SkippedMessages, result.Skipped)
+	}
+	if m := result.Skipped[0]; m.Type != websocket.TextMessage || string(m.Data) != `{"type":"heartbeat"}` || m.Received > result.MessageRoundTrip {
+		t.Errorf("Unexpected skipped message: %+v", m)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "Skipped messages: 2") {
+		t.Errorf("Expected the skipped messages in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.SkippedMessages != 2 || len(decoded.Skipped) != 1 || string(decoded.Skipped[0].Data) != `{"type":"heartbeat"}` {
+		t.Errorf("Unexpected decoded skipped messages: %s", data)
+	}
+
+	// The JSON round trip skips the heartbeat, and the binary message which is not JSON
+	_, resp, err := MeasureLatencyJSONContext(context.Background(), url, map[string]any{"id": "abc"}, http.Header{},
+		WithMatcher(MatchRegexp(regexp.MustCompile(`"id":"abc"`))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m, ok := resp.(map[string]any); !ok || m["id"] != "abc" {
+		t.Errorf("Unexpected JSON response: %v", resp)
+	}
+
+	// Without a matcher the heartbeat is taken for the response
+	_, response, err = MeasureLatencyContext(context.Background(), url, "hi", http.Header{})
+	if err != nil || string(response) != `{"type":"heartbeat"}` {
+		t.Errorf("Expected the heartbeat as response, got %s: %v", response, err)
+	}
+}
+
+func TestMatchJSONPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		value any
+		data  string
+		want  bool
+	}{
+		{"id", 1, `{"id":1}`, true},
+		{"id", 1, `{"id":1.0}`, true},
+		{"id", "1", `{"id":1}`, false},
+		{"result.subscription", "abc", `{"result":{"subscription":"abc"}}`, true},
+		{"0", "EOSE", `["EOSE","sub"]`, true},
+		{"1", "sub", `["EOSE","sub"]`, true},
+		{"2", "sub", `["EOSE","sub"]`, false},
+		{"params.0", []string{"a"}, `{"params":[["a"]]}`, true},
+		{"id", nil, `{"id":null}`, true},
+		{"id", nil, `{}`, false},
+		{"id", 1, `not JSON`, false},
+		{"id.x", 1, `{"id":1}`, false},
+	}
+	for _, tt := range tests {
+		if got := MatchJSONPath(tt.path, tt.value)(websocket.TextMessage, []byte(tt.data)); got != tt.want {
+			t.Errorf("MatchJSONPath(%q, %v) on %s: expected %t, got %t", tt.path, tt.value, tt.data, tt.want, got)
+		}
+	}
+}
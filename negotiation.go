@@ -0,0 +1,82 @@
+package wsstat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrSubprotocolRejected is returned by Dial when subprotocols were offered and the server
+// accepted none of them, or selected one that was not offered.
+var ErrSubprotocolRejected = errors.New("server accepted none of the offered subprotocols")
+
+// Extension is a WebSocket extension negotiated in the handshake, such as permessage-deflate.
+type Extension struct {
+	Name   string            // Name of the extension
+	Params map[string]string // Parameters of the extension, with "" as the value of those without one
+}
+
+// String returns the extension in the form of the Sec-WebSocket-Extensions header,
+// with its parameters sorted by name.
+func (e Extension) String() string {
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(e.Name)
+	for _, name := range names {
+		b.WriteString("; ")
+		b.WriteString(name)
+		if value := e.Params[name]; value != "" {
+			b.WriteString("=")
+			b.WriteString(value)
+		}
+	}
+	return b.String()
+}
+
+// parseExtensions parses the Sec-WebSocket-Extensions headers of a handshake response, see RFC 6455 section 9.1.
+func parseExtensions(header http.Header) []Extension {
+	var extensions []Extension
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, item := range strings.Split(value, ",") {
+			parts := strings.Split(item, ";")
+			name := strings.TrimSpace(parts[0])
+			if name == "" {
+				continue
+			}
+			ext := Extension{Name: name, Params: map[string]string{}}
+			for _, param := range parts[1:] {
+				key, value, _ := strings.Cut(param, "=")
+				key = strings.TrimSpace(key)
+				if key == "" {
+					continue
+				}
+				ext.Params[key] = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// checkSubprotocol returns an error wrapping ErrSubprotocolRejected if subprotocols were offered
+// and the server did not select one of them.
+func checkSubprotocol(offered []string, selected string) error {
+	if len(offered) == 0 {
+		return nil
+	}
+	if selected == "" {
+		return fmt.Errorf("%w: offered %s", ErrSubprotocolRejected, strings.Join(offered, ", "))
+	}
+	for _, subprotocol := range offered {
+		if subprotocol == selected {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: server selected %q, offered %s", ErrSubprotocolRejected, selected, strings.Join(offered, ", "))
+}
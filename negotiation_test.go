@@ -0,0 +1,105 @@
+package wsstat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// startNegotiatingServer starts an echo server supporting the "nostr" subprotocol and compression.
+func startNegotiatingServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{
+		CheckOrigin:       func(*http.Request) bool { return true },
+		Subprotocols:      []string{"nostr"},
+		EnableCompression: true,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, message, err := conn.ReadMessage()
+			if err != nil || conn.WriteMessage(mt, message) != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	u := wsURL(t, startNegotiatingServer(t), "/")
+
+	result, _, err := MeasureLatency(u, "hi", http.Header{}, WithSubprotocols("mqtt", "nostr"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Subprotocol != "nostr" {
+		t.Errorf("Expected the nostr subprotocol, got %q", result.Subprotocol)
+	}
+	if got := result.RequestHeaders["Sec-WebSocket-Protocol"]; len(got) != 1 || got[0] != "mqtt, nostr" {
+		t.Errorf("Expected the offered subprotocols in the request headers, got %q", got)
+	}
+
+	result, _, err = MeasureLatency(u, "hi", http.Header{}, WithSubprotocols("mqtt"))
+	if !errors.Is(err, ErrSubprotocolRejected) || ErrorPhase(err) != PhaseWSUpgrade {
+		t.Errorf("Expected the subprotocol to be rejected in the upgrade, got %v", err)
+	}
+	if result.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected the response to be kept, got status %d", result.StatusCode)
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	u := wsURL(t, startNegotiatingServer(t), "/")
+
+	result, response, err := MeasureLatency(u, "Hello, deflate!", http.Header{}, WithCompression())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(response) != "Hello, deflate!" {
+		t.Errorf("Unexpected response: %s", response)
+	}
+	if len(result.Extensions) != 1 || result.Extensions[0].Name != "permessage-deflate" {
+		t.Fatalf("Expected permessage-deflate to be negotiated, got %v", result.Extensions)
+	}
+	if _, ok := result.Extensions[0].Params["server_no_context_takeover"]; !ok {
+		t.Errorf("Expected server_no_context_takeover, got %v", result.Extensions[0])
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "Extension: permessage-deflate; client_no_context_takeover") {
+		t.Errorf("Expected the extension in the output:\n%s", out)
+	}
+
+	result, _, err = MeasureLatency(u, "Hello!", http.Header{})
+	if err != nil || len(result.Extensions) != 0 {
+		t.Errorf("Expected no extensions without WithCompression, got %v (%v)", result.Extensions, err)
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	header := http.Header{}
+	header.Add("Sec-WebSocket-Extensions", `permessage-deflate; server_max_window_bits=10; client_max_window_bits="12", x-foo`)
+	header.Add("Sec-WebSocket-Extensions", "x-bar;baz")
+	extensions := parseExtensions(header)
+	if len(extensions) != 3 {
+		t.Fatalf("Expected 3 extensions, got %v", extensions)
+	}
+	deflate := extensions[0]
+	if deflate.Params["server_max_window_bits"] != "10" || deflate.Params["client_max_window_bits"] != "12" {
+		t.Errorf("Unexpected parameters: %v", deflate.Params)
+	}
+	if got := deflate.String(); got != "permessage-deflate; client_max_window_bits=12; server_max_window_bits=10" {
+		t.Errorf("Unexpected string form: %s", got)
+	}
+	if extensions[1].Name != "x-foo" || extensions[2].String() != "x-bar; baz" {
+		t.Errorf("Unexpected extensions: %v", extensions[1:])
+	}
+}
@@ -0,0 +1,168 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// Event is a Nostr event, see NIP-01.
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// Key is a secp256k1 private key signing events.
+type Key struct {
+	private *btcec.PrivateKey
+}
+
+// GenerateKey returns a new random key.
+func GenerateKey() (*Key, error) {
+	private, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Key{private}, nil
+}
+
+// ParseKey returns the key of a hex-encoded 32-byte private key.
+func ParseKey(s string) (*Key, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("private key must be 32 hex-encoded bytes")
+	}
+	private, _ := btcec.PrivKeyFromBytes(b)
+	return &Key{private}, nil
+}
+
+// PublicKey returns the hex-encoded x-only public key, as used in events.
+func (k *Key) PublicKey() string {
+	return hex.EncodeToString(schnorr.SerializePubKey(k.private.PubKey()))
+}
+
+// NewEvent returns an unsigned event of the given kind created now.
+func NewEvent(kind int, tags [][]string, content string) *Event {
+	if tags == nil {
+		tags = [][]string{}
+	}
+	return &Event{CreatedAt: time.Now().Unix(), Kind: kind, Tags: tags, Content: content}
+}
+
+// Sign sets the public key, ID and signature of the event.
+func (e *Event) Sign(key *Key) error {
+	e.PubKey = key.PublicKey()
+	id := e.hash()
+	sig, err := schnorr.Sign(key.private, id[:])
+	if err != nil {
+		return err
+	}
+	e.ID = hex.EncodeToString(id[:])
+	e.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// Verify reports whether the event ID matches its content and the signature is valid.
+func (e *Event) Verify() error {
+	id := e.hash()
+	if e.ID != hex.EncodeToString(id[:]) {
+		return errors.New("event ID does not match its content")
+	}
+	pub, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	pubKey, err := schnorr.ParsePubKey(pub)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	raw, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	sig, err := schnorr.ParseSignature(raw)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !sig.Verify(id[:], pubKey) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// hash returns the SHA-256 of the event's serialization, which is its ID.
+func (e *Event) hash() [32]byte {
+	return sha256.Sum256([]byte(e.serialize()))
+}
+
+// serialize returns [0,pubkey,created_at,kind,tags,content] without whitespace and with only the
+// escapes NIP-01 allows, which encoding/json does not guarantee.
+func (e *Event) serialize() string {
+	var b strings.Builder
+	b.WriteString(`[0,`)
+	writeString(&b, e.PubKey)
+	b.WriteString(",")
+	b.WriteString(strconv.FormatInt(e.CreatedAt, 10))
+	b.WriteString(",")
+	b.WriteString(strconv.Itoa(e.Kind))
+	b.WriteString(",[")
+	for i, tag := range e.Tags {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("[")
+		for j, value := range tag {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			writeString(&b, value)
+		}
+		b.WriteString("]")
+	}
+	b.WriteString("],")
+	writeString(&b, e.Content)
+	b.WriteString("]")
+	return b.String()
+}
+
+// writeString writes s as a JSON string, escaping only what NIP-01 requires.
+func writeString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\n':
+			b.WriteString(`\n`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
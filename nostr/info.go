@@ -0,0 +1,101 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxInfoSize is the largest relay information document read.
+const maxInfoSize = 1 << 20
+
+// RelayInfo is the relay information document a relay serves over HTTP, see NIP-11.
+type RelayInfo struct {
+	Name          string      `json:"name,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	PubKey        string      `json:"pubkey,omitempty"`
+	Contact       string      `json:"contact,omitempty"`
+	Software      string      `json:"software,omitempty"`
+	Version       string      `json:"version,omitempty"`
+	SupportedNIPs []int       `json:"supported_nips,omitempty"`
+	Limitation    *Limitation `json:"limitation,omitempty"`
+}
+
+// Limitation holds the limits a relay imposes on its clients, see NIP-11.
+type Limitation struct {
+	MaxMessageLength    int   `json:"max_message_length,omitempty"`
+	MaxSubscriptions    int   `json:"max_subscriptions,omitempty"`
+	MaxLimit            int   `json:"max_limit,omitempty"`
+	MaxSubIDLength      int   `json:"max_subid_length,omitempty"`
+	MaxEventTags        int   `json:"max_event_tags,omitempty"`
+	MaxContentLength    int   `json:"max_content_length,omitempty"`
+	MinPowDifficulty    int   `json:"min_pow_difficulty,omitempty"`
+	AuthRequired        bool  `json:"auth_required,omitempty"`
+	PaymentRequired     bool  `json:"payment_required,omitempty"`
+	RestrictedWrites    bool  `json:"restricted_writes,omitempty"`
+	CreatedAtLowerLimit int64 `json:"created_at_lower_limit,omitempty"`
+	CreatedAtUpperLimit int64 `json:"created_at_upper_limit,omitempty"`
+	DefaultLimit        int   `json:"default_limit,omitempty"`
+}
+
+// Info is the fetch of the relay information document, see Probe.FetchInfo.
+type Info struct {
+	Latency    time.Duration // Time from sending the request to reading the whole document
+	StatusCode int           // HTTP status code of the response
+	RemoteAddr string        // Address the request was sent to
+	Resumed    bool          // Whether the TLS handshake resumed the session of the WebSocket connection
+	Document   *RelayInfo    // Parsed document, nil if the fetch failed
+	Err        error         // Error of the fetch, nil if it succeeded
+}
+
+// fetchInfo fetches the relay information document of the relay at the WebSocket URL u with client.
+func fetchInfo(ctx context.Context, client *http.Client, u *url.URL) *Info {
+	info := &Info{}
+	info.Err = info.fetch(ctx, client, u)
+	return info
+}
+
+// fetch requests the document from the HTTP URL of u, recording the response in info.
+func (info *Info) fetch(ctx context.Context, client *http.Client, u *url.URL) error {
+	httpURL := *u
+	httpURL.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(conn httptrace.GotConnInfo) {
+			info.RemoteAddr = conn.Conn.RemoteAddr().String()
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, httpURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/nostr+json")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxInfoSize))
+	info.Latency = time.Since(start)
+	info.StatusCode = resp.StatusCode
+	info.Resumed = resp.TLS != nil && resp.TLS.DidResume
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var doc RelayInfo
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("invalid relay information document: %w", err)
+	}
+	info.Document = &doc
+	return nil
+}
@@ -0,0 +1,458 @@
+// Package nostr probes Nostr relays with wsstat.
+//
+// Instead of sending any message and timing the first reply, which from a relay is often a
+// NOTICE or an unrelated event, the probe speaks NIP-01: it subscribes with a REQ and times
+// the first EVENT and the EOSE of the subscription, optionally publishes a signed EVENT and
+// times its OK, and closes the subscription with a CLOSE. Replies are matched by subscription
+// and event ID. The probe can also answer the AUTH challenge of NIP-42 and fetch the relay
+// information document of NIP-11.
+package nostr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat"
+	"github.com/relaytools/go-wsstat/internal/jsonutil"
+)
+
+// Filter is a REQ filter, such as {"kinds": [1], "limit": 1}, see NIP-01.
+type Filter map[string]any
+
+// Probe describes the exchanges of a probe.
+type Probe struct {
+	Filter         Filter // Filter of the subscription, defaults to {"limit": 1}
+	SubscriptionID string // ID of the subscription, random if empty
+	Publish        *Event // Signed event to publish after the subscription, if any
+	AuthKey        *Key   // Key answering the AUTH challenge the relay sends after the upgrade, if any
+	FetchInfo      bool   // Whether to fetch the relay information document after the probe
+}
+
+// Result holds the timings of a probe: those of the connection, in the embedded wsstat.Result,
+// followed by those of the Nostr exchanges, each measured from sending the request.
+// The MessageRoundTrip of the embedded result is the time to the first reply to the REQ.
+type Result struct {
+	wsstat.Result
+
+	Challenge     string        // AUTH challenge of the relay, if it sent one
+	AuthChallenge time.Duration // Time from the upgrade to the AUTH challenge, if the probe authenticated
+	Auth          time.Duration // Time from the AUTH challenge to the OK of the AUTH event
+	Authenticated bool          // Whether the relay accepted the AUTH event
+	AuthMessage   string        // Message of the OK of the AUTH event
+
+	FirstEvent time.Duration // Time to the first EVENT of the subscription, 0 if the relay had none
+	EOSE       time.Duration // Time to the EOSE of the subscription
+	Events     int           // Number of stored events received before the EOSE
+	Publish    time.Duration // Time to the OK of the published event, if one was published
+	Accepted   bool          // Whether the relay accepted the published event
+	OKMessage  string        // Message of the OK, such as "duplicate: already have this event"
+	Closed     string        // Reason the relay gave for closing the subscription, if it did
+	Notices    []string      // NOTICE messages received
+
+	Info *Info // Fetch of the relay information document, if requested with Probe.FetchInfo
+}
+
+// KindAuth is the kind of the events answering AUTH challenges, see NIP-42.
+const KindAuth = 22242
+
+// ErrClosed is returned when the relay closes the subscription with a CLOSED message instead of
+// serving it, for instance with an "auth-required:" or "restricted:" reason.
+var ErrClosed = errors.New("relay closed the subscription")
+
+// Measure connects to the relay at url, runs the probe and closes the connection.
+// A rejected event is reported in the result, not as an error. On failure the result holds
+// the timings of the exchanges that completed.
+//
+// If the probe fetches the relay information document, it is fetched once the connection is
+// closed, from the address of the connection and resuming its TLS session where the relay
+// allows it, see wsstat.WSStat.HTTPClient. A failed fetch is reported in Result.Info.
+func Measure(ctx context.Context, url *url.URL, p Probe, opts ...wsstat.Option) (Result, error) {
+	var r Result
+	ws := wsstat.NewWSStat(opts...)
+	if err := ws.DialContext(ctx, url, nil); err != nil {
+		r.Result = *ws.Result
+		return r, err
+	}
+	err := r.run(ctx, ws, url, p)
+	if err != nil {
+		ws.Abort()
+	} else {
+		err = ws.CloseConnContext(ctx)
+	}
+	r.Result = *ws.Result
+	if p.FetchInfo {
+		r.Info = fetchInfo(ctx, ws.HTTPClient(), url)
+	}
+	return r, err
+}
+
+// run authenticates if the probe has a key, subscribes, publishes the event if any, and closes
+// the subscription.
+func (r *Result) run(ctx context.Context, ws *wsstat.WSStat, relay *url.URL, p Probe) error {
+	if p.AuthKey != nil {
+		if err := r.authenticate(ctx, ws, relay, p.AuthKey); err != nil {
+			return readError(ws, err)
+		}
+		// The reads of the authentication are not the message round trip
+		ws.Result.MessageRoundTrip = 0
+		ws.Result.FirstMessageResponse = 0
+	}
+
+	subID := p.SubscriptionID
+	if subID == "" {
+		subID = randomID()
+	}
+	filter := p.Filter
+	if filter == nil {
+		filter = Filter{"limit": 1}
+	}
+
+	// Subscribe and read the stored events until the EOSE
+	start, err := send(ctx, ws, "REQ", subID, filter)
+	if err != nil {
+		return err
+	}
+	// Each read sets the message round trip, which is reset to the first reply to the REQ
+	var firstReply time.Duration
+	defer func() {
+		if firstReply > 0 {
+			ws.Result.MessageRoundTrip = firstReply
+			ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + firstReply
+		}
+	}()
+	err = r.readUntil(ctx, ws, start, func(label string, msg []json.RawMessage) (bool, error) {
+		if len(msg) < 2 || decodeString(msg[1]) != subID {
+			return false, nil
+		}
+		if firstReply == 0 {
+			firstReply = time.Since(start)
+		}
+		switch label {
+		case "EVENT":
+			if r.Events == 0 {
+				r.FirstEvent = time.Since(start)
+			}
+			r.Events++
+		case "EOSE":
+			r.EOSE = time.Since(start)
+			return true, nil
+		case "CLOSED":
+			if len(msg) > 2 {
+				r.Closed = decodeString(msg[2])
+			}
+			return true, fmt.Errorf("%w: %s", ErrClosed, r.Closed)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return readError(ws, err)
+	}
+
+	// Close the subscription, so the relay stops sending its events
+	if _, err := send(ctx, ws, "CLOSE", subID); err != nil {
+		return err
+	}
+
+	if p.Publish == nil {
+		return nil
+	}
+	start, err = send(ctx, ws, "EVENT", p.Publish)
+	if err != nil {
+		return err
+	}
+	err = r.readUntil(ctx, ws, start, func(label string, msg []json.RawMessage) (bool, error) {
+		if label != "OK" || len(msg) < 3 || decodeString(msg[1]) != p.Publish.ID {
+			return false, nil
+		}
+		r.Publish = time.Since(start)
+		json.Unmarshal(msg[2], &r.Accepted)
+		if len(msg) > 3 {
+			r.OKMessage = decodeString(msg[3])
+		}
+		return true, nil
+	})
+	return readError(ws, err)
+}
+
+// authenticate waits for the AUTH challenge of the relay and answers it with an event signed by
+// key, see NIP-42. A rejected AUTH event is recorded in the result, not returned as an error.
+func (r *Result) authenticate(ctx context.Context, ws *wsstat.WSStat, relay *url.URL, key *Key) error {
+	// The relay sends its challenge on its own, timed from the end of the upgrade
+	start := ws.Result.Start.Add(ws.Result.WSHandshakeDone)
+	var challenged time.Time
+	err := r.readUntil(ctx, ws, start, func(label string, msg []json.RawMessage) (bool, error) {
+		if label != "AUTH" || r.Challenge == "" {
+			return false, nil
+		}
+		challenged = time.Now()
+		r.AuthChallenge = challenged.Sub(start)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ev := NewEvent(KindAuth, [][]string{{"relay", relay.String()}, {"challenge", r.Challenge}}, "")
+	if err := ev.Sign(key); err != nil {
+		return err
+	}
+	if _, err := send(ctx, ws, "AUTH", ev); err != nil {
+		return err
+	}
+	return r.readUntil(ctx, ws, challenged, func(label string, msg []json.RawMessage) (bool, error) {
+		if label != "OK" || len(msg) < 3 || decodeString(msg[1]) != ev.ID {
+			return false, nil
+		}
+		r.Auth = time.Since(challenged)
+		json.Unmarshal(msg[2], &r.Authenticated)
+		if len(msg) > 3 {
+			r.AuthMessage = decodeString(msg[3])
+		}
+		return true, nil
+	})
+}
+
+// readUntil reads relay messages until handle reports it is done, recording the notices and
+// the AUTH challenge. The read timeout of ws bounds the whole exchange from start, so a relay
+// streaming unrelated messages cannot hold it open.
+// Messages that are not JSON arrays starting with a string are skipped.
+func (r *Result) readUntil(ctx context.Context, ws *wsstat.WSStat, start time.Time, handle func(label string, msg []json.RawMessage) (bool, error)) error {
+	ctx, cancel := context.WithDeadline(ctx, start.Add(ws.ReadTimeout()))
+	defer cancel()
+	for {
+		_, data, err := ws.ReadMessageContext(ctx, start)
+		if err != nil {
+			return err
+		}
+		var msg []json.RawMessage
+		if json.Unmarshal(data, &msg) != nil || len(msg) == 0 {
+			continue
+		}
+		label := decodeString(msg[0])
+		if label == "NOTICE" && len(msg) > 1 {
+			r.Notices = append(r.Notices, decodeString(msg[1]))
+			continue
+		}
+		if label == "AUTH" && len(msg) > 1 {
+			r.Challenge = decodeString(msg[1])
+		}
+		if done, err := handle(label, msg); done || err != nil {
+			return err
+		}
+	}
+}
+
+// send writes a relay request made of the label and the arguments, returning when it was sent.
+func send(ctx context.Context, ws *wsstat.WSStat, label string, args ...any) (time.Time, error) {
+	data, err := json.Marshal(append([]any{label}, args...))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ws.WriteMessageContext(ctx, websocket.TextMessage, data)
+}
+
+// readError attributes an error of the exchange that is not a wsstat.PhaseError to the read phase.
+func readError(ws *wsstat.WSStat, err error) error {
+	if err == nil || wsstat.ErrorPhase(err) != wsstat.PhaseNone {
+		return err
+	}
+	ws.Result.FailedPhase = wsstat.PhaseRead
+	return &wsstat.PhaseError{Phase: wsstat.PhaseRead, Err: err}
+}
+
+// decodeString returns the string encoded in raw, or "" if it is not a string.
+func decodeString(raw json.RawMessage) string {
+	var s string
+	json.Unmarshal(raw, &s)
+	return s
+}
+
+// randomID returns a random subscription ID.
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "wsstat-" + hex.EncodeToString(b)
+}
+
+// Format formats the result like wsstat.Result, followed by the Nostr exchanges.
+func (r Result) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v", r.Result)
+			fmt.Fprintf(s, "\nNostr\n")
+			if r.Challenge != "" {
+				fmt.Fprintf(s, "  Auth challenge: %s\n", r.Challenge)
+			}
+			if r.Auth > 0 {
+				fmt.Fprintf(s, "  Challenge:      %4d ms\n", int(r.AuthChallenge/time.Millisecond))
+				fmt.Fprintf(s, "  Auth OK:        %4d ms (accepted: %t", int(r.Auth/time.Millisecond), r.Authenticated)
+				if r.AuthMessage != "" {
+					fmt.Fprintf(s, ", %s", r.AuthMessage)
+				}
+				fmt.Fprintf(s, ")\n")
+			}
+			if r.Events > 0 {
+				fmt.Fprintf(s, "  First event:    %4d ms\n", int(r.FirstEvent/time.Millisecond))
+			}
+			if r.EOSE > 0 {
+				fmt.Fprintf(s, "  EOSE:           %4d ms (%d events)\n", int(r.EOSE/time.Millisecond), r.Events)
+			}
+			if r.Closed != "" {
+				fmt.Fprintf(s, "  Closed: %s\n", r.Closed)
+			}
+			if r.Publish > 0 {
+				fmt.Fprintf(s, "  Publish OK:     %4d ms (accepted: %t", int(r.Publish/time.Millisecond), r.Accepted)
+				if r.OKMessage != "" {
+					fmt.Fprintf(s, ", %s", r.OKMessage)
+				}
+				fmt.Fprintf(s, ")\n")
+			}
+			for _, notice := range r.Notices {
+				fmt.Fprintf(s, "  Notice: %s\n", notice)
+			}
+			if info := r.Info; info != nil {
+				fmt.Fprintf(s, "\nRelay information\n")
+				if info.Err != nil {
+					fmt.Fprintf(s, "  Error: %v\n", info.Err)
+				}
+				if info.StatusCode != 0 {
+					fmt.Fprintf(s, "  Fetch:          %4d ms (%s, TLS resumed: %t)\n",
+						int(info.Latency/time.Millisecond), info.RemoteAddr, info.Resumed)
+				}
+				if doc := info.Document; doc != nil {
+					fmt.Fprintf(s, "  Name: %s\n", doc.Name)
+					fmt.Fprintf(s, "  Software: %s %s\n", doc.Software, doc.Version)
+					fmt.Fprintf(s, "  Supported NIPs: %v\n", doc.SupportedNIPs)
+					if l := doc.Limitation; l != nil {
+						fmt.Fprintf(s, "  Limitation: %+v\n", *l)
+					}
+				}
+			}
+			return
+		}
+
+		fallthrough
+	case 's', 'q':
+		fmt.Fprintf(s, "%s, Auth: %d ms, FirstEvent: %d ms, EOSE: %d ms, Publish: %d ms", r.Result,
+			r.Auth/time.Millisecond, r.FirstEvent/time.Millisecond, r.EOSE/time.Millisecond, r.Publish/time.Millisecond)
+	}
+}
+
+// nostrJSON is the JSON representation of the Nostr exchanges of Result.
+type nostrJSON struct {
+	Challenge     string            `json:"challenge,omitempty"`
+	AuthChallenge jsonutil.Duration `json:"auth_challenge,omitempty"`
+	Auth          jsonutil.Duration `json:"auth,omitempty"`
+	Authenticated bool              `json:"authenticated,omitempty"`
+	AuthMessage   string            `json:"auth_message,omitempty"`
+	FirstEvent    jsonutil.Duration `json:"first_event"`
+	EOSE          jsonutil.Duration `json:"eose"`
+	Events        int               `json:"events"`
+	Publish       jsonutil.Duration `json:"publish,omitempty"`
+	Accepted      bool              `json:"accepted,omitempty"`
+	OKMessage     string            `json:"ok_message,omitempty"`
+	Closed        string            `json:"closed,omitempty"`
+	Notices       []string          `json:"notices,omitempty"`
+	Info          *infoJSON         `json:"info,omitempty"`
+}
+
+// infoJSON is the JSON representation of Info.
+type infoJSON struct {
+	Latency    jsonutil.Duration `json:"latency"`
+	StatusCode int               `json:"status_code,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Resumed    bool              `json:"resumed"`
+	Document   *RelayInfo        `json:"document,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the result as wsstat.Result does, with the Nostr exchanges under "nostr".
+func (r Result) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	n := nostrJSON{
+		Challenge:     r.Challenge,
+		AuthChallenge: jsonutil.Duration(r.AuthChallenge),
+		Auth:          jsonutil.Duration(r.Auth),
+		Authenticated: r.Authenticated,
+		AuthMessage:   r.AuthMessage,
+		FirstEvent:    jsonutil.Duration(r.FirstEvent),
+		EOSE:          jsonutil.Duration(r.EOSE),
+		Events:        r.Events,
+		Publish:       jsonutil.Duration(r.Publish),
+		Accepted:      r.Accepted,
+		OKMessage:     r.OKMessage,
+		Closed:        r.Closed,
+		Notices:       r.Notices,
+	}
+	if info := r.Info; info != nil {
+		n.Info = &infoJSON{
+			Latency:    jsonutil.Duration(info.Latency),
+			StatusCode: info.StatusCode,
+			RemoteAddr: info.RemoteAddr,
+			Resumed:    info.Resumed,
+			Document:   info.Document,
+		}
+		if info.Err != nil {
+			n.Info.Error = info.Err.Error()
+		}
+	}
+	if out["nostr"], err = json.Marshal(n); err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Result); err != nil {
+		return err
+	}
+	var in struct {
+		Nostr nostrJSON `json:"nostr"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	n := in.Nostr
+	r.Challenge = n.Challenge
+	r.AuthChallenge = time.Duration(n.AuthChallenge)
+	r.Auth = time.Duration(n.Auth)
+	r.Authenticated = n.Authenticated
+	r.AuthMessage = n.AuthMessage
+	r.FirstEvent = time.Duration(n.FirstEvent)
+	r.EOSE = time.Duration(n.EOSE)
+	r.Events = n.Events
+	r.Publish = time.Duration(n.Publish)
+	r.Accepted = n.Accepted
+	r.OKMessage = n.OKMessage
+	r.Closed = n.Closed
+	r.Notices = n.Notices
+	if info := n.Info; info != nil {
+		r.Info = &Info{
+			Latency:    time.Duration(info.Latency),
+			StatusCode: info.StatusCode,
+			RemoteAddr: info.RemoteAddr,
+			Resumed:    info.Resumed,
+			Document:   info.Document,
+		}
+		if info.Error != "" {
+			r.Info.Err = errors.New(info.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package nostr
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat"
+)
+
+// relay serves a relay sending two stored events to any subscription, accepting events with a
+// valid signature and closing subscriptions with a filter on kind 4. If it has a challenge, it
+// sends it after the upgrade and closes subscriptions until a client authenticates.
+type relay struct {
+	challenge string
+}
+
+func (rl relay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.WriteJSON([]any{"NOTICE", "welcome"})
+	authenticated := rl.challenge == ""
+	if !authenticated {
+		conn.WriteJSON([]any{"AUTH", rl.challenge})
+	}
+	for {
+		var msg []json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		var label string
+		json.Unmarshal(msg[0], &label)
+		switch label {
+		case "REQ":
+			var subID string
+			var filter Filter
+			json.Unmarshal(msg[1], &subID)
+			json.Unmarshal(msg[2], &filter)
+			if !authenticated {
+				conn.WriteJSON([]any{"CLOSED", subID, "auth-required: members only"})
+				continue
+			}
+			if kinds, ok := filter["kinds"].([]any); ok && len(kinds) > 0 && kinds[0] == float64(4) {
+				conn.WriteJSON([]any{"CLOSED", subID, "restricted: no DMs"})
+				continue
+			}
+			conn.WriteJSON([]any{"EVENT", "other", NewEvent(1, nil, "unrelated")})
+			conn.WriteJSON([]any{"EVENT", subID, NewEvent(1, nil, "first")})
+			conn.WriteJSON([]any{"EVENT", subID, NewEvent(1, nil, "second")})
+			conn.WriteJSON([]any{"EOSE", subID})
+		case "EVENT":
+			var ev Event
+			json.Unmarshal(msg[1], &ev)
+			if err := ev.Verify(); err != nil {
+				conn.WriteJSON([]any{"OK", ev.ID, false, "invalid: " + err.Error()})
+				continue
+			}
+			conn.WriteJSON([]any{"OK", "other", false, ""})
+			conn.WriteJSON([]any{"OK", ev.ID, true, ""})
+		case "AUTH":
+			var ev Event
+			json.Unmarshal(msg[1], &ev)
+			wantTags := [][]string{{"relay", "ws://" + r.Host}, {"challenge", rl.challenge}}
+			if ev.Verify() != nil || ev.Kind != KindAuth || fmt.Sprint(ev.Tags) != fmt.Sprint(wantTags) {
+				conn.WriteJSON([]any{"OK", ev.ID, false, "auth-required: invalid AUTH event"})
+				continue
+			}
+			authenticated = true
+			conn.WriteJSON([]any{"OK", ev.ID, true, ""})
+		}
+	}
+}
+
+// startRelay starts a relay without authentication.
+func startRelay(t *testing.T) *url.URL {
+	server := httptest.NewServer(relay{})
+	t.Cleanup(server.Close)
+	return relayURL(t, server)
+}
+
+// relayURL returns the WebSocket URL of a test server.
+func relayURL(t *testing.T, server *httptest.Server) *url.URL {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	return u
+}
+
+func TestMeasure(t *testing.T) {
+	u := startRelay(t)
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	ev := NewEvent(1, [][]string{{"t", "wsstat"}}, "probe")
+	if err := ev.Sign(key); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := Measure(ctx, u, Probe{Filter: Filter{"kinds": []int{1}}, Publish: ev})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Events != 2 || result.FirstEvent <= 0 || result.EOSE < result.FirstEvent {
+		t.Errorf("Unexpected subscription results: %d events, first %v, EOSE %v", result.Events, result.FirstEvent, result.EOSE)
+	}
+	if !result.Accepted || result.Publish <= 0 {
+		t.Errorf("Expected the event to be accepted, got %t after %v: %s", result.Accepted, result.Publish, result.OKMessage)
+	}
+	if len(result.Notices) != 1 || result.Notices[0] != "welcome" {
+		t.Errorf("Unexpected notices: %v", result.Notices)
+	}
+	if result.MessageRoundTrip <= 0 || result.MessageRoundTrip > result.EOSE || result.TotalTime <= 0 {
+		t.Errorf("Unexpected connection timings: %v", result.Result)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "(2 events)") || !strings.Contains(out, "accepted: true") {
+		t.Errorf("Expected the Nostr exchanges in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.EOSE != result.EOSE || decoded.Events != 2 || !decoded.Accepted || decoded.URL.String() != u.String() {
+		t.Errorf("Unexpected decoded result: %s", data)
+	}
+}
+
+func TestMeasureRejected(t *testing.T) {
+	u := startRelay(t)
+	key, _ := GenerateKey()
+	ev := NewEvent(1, nil, "probe")
+	if err := ev.Sign(key); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	ev.Content = "tampered"
+
+	result, err := Measure(context.Background(), u, Probe{Publish: ev})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Accepted || !strings.HasPrefix(result.OKMessage, "invalid:") {
+		t.Errorf("Expected the event to be rejected, got %t: %s", result.Accepted, result.OKMessage)
+	}
+}
+
+func TestMeasureClosed(t *testing.T) {
+	u := startRelay(t)
+	result, err := Measure(context.Background(), u, Probe{Filter: Filter{"kinds": []int{4}}, SubscriptionID: "dms"})
+	if !errors.Is(err, ErrClosed) || wsstat.ErrorPhase(err) != wsstat.PhaseRead {
+		t.Fatalf("Expected ErrClosed in the read phase, got %v", err)
+	}
+	if result.Closed != "restricted: no DMs" || result.FailedPhase != wsstat.PhaseRead || result.MessageRoundTrip <= 0 {
+		t.Errorf("Unexpected result: closed %q, failed phase %s", result.Closed, result.FailedPhase)
+	}
+}
+
+func TestMeasureReadTimeout(t *testing.T) {
+	// A relay answering the subscription with notices only, never with its EOSE
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for conn.WriteJSON([]any{"NOTICE", "busy"}) == nil {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	start := time.Now()
+	result, err := Measure(context.Background(), relayURL(t, server), Probe{}, wsstat.WithReadTimeout(200*time.Millisecond))
+	if wsstat.ErrorPhase(err) != wsstat.PhaseRead || result.FailedPhase != wsstat.PhaseRead {
+		t.Fatalf("Expected read phase error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the read timeout to bound the exchange, took %v", elapsed)
+	}
+	if len(result.Notices) == 0 {
+		t.Error("Expected the notices to be recorded")
+	}
+}
+
+func TestEventSignature(t *testing.T) {
+	key, err := ParseKey("0000000000000000000000000000000000000000000000000000000000000003")
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	// Public key of the BIP-340 test vector with secret key 3
+	if got := key.PublicKey(); got != "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9" {
+		t.Errorf("Unexpected public key: %s", got)
+	}
+
+	ev := NewEvent(1, [][]string{{"e", "abc"}}, "line\nbreak \"quoted\" \\ tab\t")
+	if err := ev.Sign(key); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	if err := ev.Verify(); err != nil {
+		t.Errorf("Expected a valid event, got %v", err)
+	}
+	ev.Tags[0][1] = "abd"
+	if err := ev.Verify(); err == nil {
+		t.Error("Expected an error for a modified event")
+	}
+
+	if _, err := ParseKey("abc"); err == nil {
+		t.Error("Expected an error for a short key")
+	}
+}
+
+func TestMeasureAuth(t *testing.T) {
+	server := httptest.NewServer(relay{challenge: "challenge-123"})
+	t.Cleanup(server.Close)
+	u := relayURL(t, server)
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	result, err := Measure(context.Background(), u, Probe{AuthKey: key})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Challenge != "challenge-123" || !result.Authenticated || result.Auth <= 0 || result.AuthChallenge <= 0 {
+		t.Errorf("Unexpected authentication: challenge %q, accepted %t after %v: %s",
+			result.Challenge, result.Authenticated, result.Auth, result.AuthMessage)
+	}
+	if result.Events != 2 || result.MessageRoundTrip <= 0 || result.MessageRoundTrip > result.EOSE {
+		t.Errorf("Unexpected subscription results: %d events, round trip %v, EOSE %v", result.Events, result.MessageRoundTrip, result.EOSE)
+	}
+
+	// Without a key the challenge is recorded, and the relay closes the subscription
+	result, err = Measure(context.Background(), u, Probe{})
+	if !errors.Is(err, ErrClosed) || result.Challenge != "challenge-123" || result.Auth != 0 {
+		t.Errorf("Expected an unauthenticated probe to be closed, got %v with challenge %q", err, result.Challenge)
+	}
+}
+
+func TestMeasureInfo(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/nostr+json" {
+			relay{}.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/nostr+json")
+		io.WriteString(w, `{"name": "test relay", "software": "git+https://example.com/relay.git", "version": "1.2.3",
+			"supported_nips": [1, 11, 42], "limitation": {"max_subscriptions": 20, "auth_required": true}}`)
+	}))
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	result, err := Measure(context.Background(), relayURL(t, server), Probe{FetchInfo: true},
+		wsstat.WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := result.Info
+	if info == nil || info.Err != nil || info.StatusCode != http.StatusOK || info.Latency <= 0 {
+		t.Fatalf("Unexpected fetch: %+v", info)
+	}
+	// The document is fetched from the address of the WebSocket connection, resuming its TLS session
+	if info.RemoteAddr != result.RemoteAddr || !info.Resumed {
+		t.Errorf("Expected a resumed session with %s, got %s (resumed: %t)", result.RemoteAddr, info.RemoteAddr, info.Resumed)
+	}
+	doc := info.Document
+	if doc.Name != "test relay" || doc.Version != "1.2.3" || len(doc.SupportedNIPs) != 3 ||
+		doc.Limitation == nil || doc.Limitation.MaxSubscriptions != 20 || !doc.Limitation.AuthRequired {
+		t.Errorf("Unexpected document: %+v", doc)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "Software: git+https://example.com/relay.git 1.2.3") {
+		t.Errorf("Expected the relay information in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.Info == nil || decoded.Info.Document.Software != doc.Software || decoded.Info.Latency != info.Latency {
+		t.Errorf("Unexpected decoded result: %s", data)
+	}
+}
+
+func TestMeasureInfoError(t *testing.T) {
+	// The relay serves its WebSocket endpoint for any request, so the document is not JSON
+	result, err := Measure(context.Background(), startRelay(t), Probe{FetchInfo: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Info == nil || result.Info.Err == nil || result.Info.Document != nil {
+		t.Errorf("Expected a failed fetch, got %+v", result.Info)
+	}
+}
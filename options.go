@@ -0,0 +1,261 @@
+package wsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Option configures a WSStat instance, see NewWSStat.
+type Option func(*config)
+
+// config holds the per-instance configuration of a WSStat.
+// Fields not set by an Option take their value from the package defaults,
+// see SetCustomTLSConfig, SetDialTimeout, SetLogger and SetLogLevel.
+type config struct {
+	tlsConfig    *tls.Config
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	logger       zerolog.Logger
+	headers      http.Header
+	subprotocols []string
+	compression  bool
+	proxy        *url.URL
+	dialIP       net.IP
+	network      string
+	resolver     Resolver
+	dialFunc     DialFunc
+	transport    string
+	clientCerts  []tls.Certificate
+
+	matcher        Matcher
+	captureSkipped int
+
+	happyEyeballs bool
+	fallbackDelay time.Duration
+
+	// sessionCache caches the TLS sessions of the instance unless the TLS configuration
+	// has its own cache, so that the requests of WSStat.HTTPClient can resume them.
+	sessionCache tls.ClientSessionCache
+}
+
+// newConfig returns a config initialized from the package defaults with the options applied.
+func newConfig(opts ...Option) *config {
+	cfg := &config{
+		tlsConfig:   customTLSConfig,
+		dialTimeout: dialTimeout,
+		readTimeout: readTimeout,
+		logger:      logger,
+		network:     "tcp",
+		resolver:    systemResolver{},
+		headers: http.Header{
+			"Origin": {"http://example.com"}, // Required by some servers
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.sessionCache = tls.NewLRUClientSessionCache(1)
+	return cfg
+}
+
+// clientTLSConfig returns a copy of the TLS configuration for a connection, with the client
+// certificates and the session cache of the instance.
+func (c *config) clientTLSConfig() *tls.Config {
+	var tlsConfig *tls.Config
+	if c.tlsConfig != nil {
+		tlsConfig = c.tlsConfig.Clone()
+	} else {
+		// Fall back to a default configuration
+		tlsConfig = &tls.Config{}
+	}
+	n := len(tlsConfig.Certificates)
+	tlsConfig.Certificates = append(tlsConfig.Certificates[:n:n], c.clientCerts...)
+	if tlsConfig.ClientSessionCache == nil {
+		tlsConfig.ClientSessionCache = c.sessionCache
+	}
+	return tlsConfig
+}
+
+// WithTLSConfig sets the TLS configuration used for wss:// connections.
+// If the configuration has no ServerName, the host of the dialed URL is used.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithClientCertificate presents cert to servers that request a client certificate, in addition
+// to the certificates of the TLS configuration. See LoadClientCertificate and LoadPKCS12.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(c *config) {
+		c.clientCerts = append(c.clientCerts, cert)
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing the TCP connection.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.dialTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets how long to wait for a response message or pong.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.readTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger used by the instance.
+func WithLogger(l zerolog.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithHeaders replaces the default headers sent with the WebSocket handshake request,
+// which otherwise consist of "Origin: http://example.com".
+// Headers passed to Dial are merged on top of these.
+func WithHeaders(headers http.Header) Option {
+	return func(c *config) {
+		c.headers = headers.Clone()
+	}
+}
+
+// WithSubprotocols sets the subprotocols offered in the WebSocket handshake.
+func WithSubprotocols(subprotocols ...string) Option {
+	return func(c *config) {
+		c.subprotocols = subprotocols
+	}
+}
+
+// WithCompression offers the permessage-deflate extension in the WebSocket handshake, see RFC 7692.
+// Only the variant without context takeover is supported; the negotiated extensions are
+// reported in Result.Extensions.
+func WithCompression() Option {
+	return func(c *config) {
+		c.compression = true
+	}
+}
+
+// WithMatcher sets the matcher identifying the response to a message, for servers that push
+// heartbeats, notices or broadcasts between a message and its response. The round-trip timer stops
+// on the first message the matcher accepts; the others are counted in Result.SkippedMessages.
+// Without a matcher, the first message received is the response. Pings are not affected.
+func WithMatcher(m Matcher) Option {
+	return func(c *config) {
+		c.matcher = m
+	}
+}
+
+// WithCaptureSkipped captures up to limit of the messages skipped by the matcher in Result.Skipped.
+func WithCaptureSkipped(limit int) Option {
+	return func(c *config) {
+		c.captureSkipped = limit
+	}
+}
+
+// WithProxy tunnels the connection through the proxy at proxyURL. The scheme selects the protocol:
+// "http" or "https" for an HTTP proxy using the CONNECT method, or "socks5" or "socks5h" for a
+// SOCKS5 proxy such as Tor. The host name is resolved locally with the configured resolver for
+// "socks5", and by the proxy otherwise. Credentials in the URL are sent with basic
+// authentication, or SOCKS5 username/password authentication.
+// When set, the DNS lookup and TCP connection times refer to the proxy, with the DNS lookup
+// including the local resolution for "socks5", and the time to open the tunnel is recorded in
+// Result.ProxyConnect.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(c *config) {
+		c.proxy = proxyURL
+	}
+}
+
+// WithDialAddress connects to the given IP address instead of the first address the host resolves to.
+// The host name is still resolved, and used for the Host header and TLS server name.
+// With a proxy, the proxy is asked to connect to the address.
+func WithDialAddress(ip net.IP) Option {
+	return func(c *config) {
+		c.dialIP = ip
+	}
+}
+
+// WithNetwork restricts the connection to one address family: "tcp4" for IPv4,
+// "tcp6" for IPv6, or "tcp", the default, for either. Only addresses of the family are resolved.
+func WithNetwork(network string) Option {
+	return func(c *config) {
+		c.network = network
+	}
+}
+
+// WithHappyEyeballs races connection attempts to the IPv6 and IPv4 addresses of the host per
+// RFC 8305, instead of connecting to the first resolved address. The preferred family gets a
+// head start of fallbackDelay, or of the recommended 250ms if zero. The outcome is recorded
+// in Result.FamilyRace.
+func WithHappyEyeballs(fallbackDelay time.Duration) Option {
+	return func(c *config) {
+		c.happyEyeballs = true
+		c.fallbackDelay = fallbackDelay
+	}
+}
+
+// WithResolver sets the resolver used to look up the host, instead of net.DefaultResolver.
+// See NewDNSResolver, NewDoTResolver and NewDoHResolver for the built-in resolvers.
+func WithResolver(r Resolver) Option {
+	return func(c *config) {
+		c.resolver = r
+	}
+}
+
+// Transports of a connection, see Result.Transport.
+const (
+	TransportTCP    = "tcp"    // TCP connection to the resolved host, possibly through a proxy
+	TransportUnix   = "unix"   // Unix domain socket, see WithUnixSocket
+	TransportCustom = "custom" // Connection of a custom dial function, see WithDialFunc and WithConn
+)
+
+// DialFunc opens the connection to the server for the WebSocket handshake, see WithDialFunc.
+// network and addr are those of the URL, such as "tcp" and "example.com:443".
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithDialFunc opens connections with dial instead of resolving the host and connecting over TCP.
+// The DNS lookup and TCP connection phases do not apply and are reported as such; the proxy and
+// resolver options are ignored. The time spent in dial counts towards the WebSocket handshake,
+// and wss:// URLs are still secured with TLS over the returned connection. An error of dial is
+// attributed to PhaseTCP, as the connect phase, which then applies, see Result.Applicable.
+func WithDialFunc(dial DialFunc) Option {
+	return func(c *config) {
+		c.dialFunc = dial
+		c.transport = TransportCustom
+	}
+}
+
+// WithUnixSocket connects to the Unix domain socket at path instead of the host of the URL,
+// which still sets the Host header, as with WithDialFunc.
+func WithUnixSocket(path string) Option {
+	return func(c *config) {
+		c.dialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := &net.Dialer{Timeout: c.dialTimeout}
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		c.transport = TransportUnix
+	}
+}
+
+// WithConn performs the WebSocket handshake over an established connection, as with WithDialFunc.
+// The connection can only be used by a single Dial.
+func WithConn(conn net.Conn) Option {
+	var used bool
+	return WithDialFunc(func(context.Context, string, string) (net.Conn, error) {
+		if used {
+			return nil, errors.New("connection already used")
+		}
+		used = true
+		return conn, nil
+	})
+}
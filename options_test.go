@@ -0,0 +1,225 @@
+package wsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+func TestNewWSStatOptions(t *testing.T) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+	ws := NewWSStat(
+		WithTLSConfig(tlsConfig),
+		WithDialTimeout(time.Second),
+		WithReadTimeout(2*time.Second),
+		WithHeaders(http.Header{"Origin": {"https://relay.example.com"}}),
+		WithSubprotocols("nostr"),
+		WithProxy(proxyURL),
+	)
+
+	if ws.cfg.tlsConfig != tlsConfig {
+		t.Error("Expected custom TLS config")
+	}
+	if ws.cfg.dialTimeout != time.Second {
+		t.Errorf("Unexpected dial timeout: %v", ws.cfg.dialTimeout)
+	}
+	if ws.cfg.readTimeout != 2*time.Second {
+		t.Errorf("Unexpected read timeout: %v", ws.cfg.readTimeout)
+	}
+	if ws.cfg.headers.Get("Origin") != "https://relay.example.com" {
+		t.Errorf("Unexpected Origin header: %s", ws.cfg.headers.Get("Origin"))
+	}
+	if len(ws.dialer.Subprotocols) != 1 || ws.dialer.Subprotocols[0] != "nostr" {
+		t.Errorf("Unexpected subprotocols: %v", ws.dialer.Subprotocols)
+	}
+	if ws.cfg.proxy != proxyURL {
+		t.Error("Expected proxy URL")
+	}
+
+	// Instances without options use the package defaults
+	ws = NewWSStat()
+	if ws.cfg.dialTimeout != dialTimeout {
+		t.Errorf("Unexpected default dial timeout: %v", ws.cfg.dialTimeout)
+	}
+	if ws.cfg.headers.Get("Origin") != "http://example.com" {
+		t.Errorf("Unexpected default Origin header: %s", ws.cfg.headers.Get("Origin"))
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	ws := NewWSStat(WithHeaders(http.Header{"Origin": {"https://relay.example.com"}}))
+	err := ws.Dial(echoServerAddrWs, http.Header{"X-Custom": {"value"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.CloseConn()
+
+	if ws.Result.RequestHeaders.Get("Origin") != "https://relay.example.com" {
+		t.Errorf("Unexpected Origin header: %v", ws.Result.RequestHeaders)
+	}
+	if ws.Result.RequestHeaders.Get("X-Custom") != "value" {
+		t.Errorf("Custom header not merged: %v", ws.Result.RequestHeaders)
+	}
+}
+
+func TestWithReadTimeout(t *testing.T) {
+	ws := NewWSStat(WithReadTimeout(100 * time.Millisecond))
+	err := ws.Dial(silentServerAddrWs, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.conn.Close()
+
+	start := time.Now()
+	if _, err := ws.SendMessage(websocket.TextMessage, []byte("Hello, world!")); err == nil {
+		t.Error("Expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read timeout not applied, took %v", elapsed)
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tunnels.Add(1)
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	result, response, err := MeasureLatency(echoServerAddrWs, "Hello, proxy!", http.Header{}, WithProxy(proxyURL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(response) != "Hello, proxy!" {
+		t.Errorf("Unexpected response: %s", response)
+	}
+	if result.TotalTime <= 0 {
+		t.Errorf("Invalid total time: %v", result.TotalTime)
+	}
+	if tunnels.Load() != 1 {
+		t.Errorf("Expected one tunnel through the proxy, got %d", tunnels.Load())
+	}
+}
+
+func TestConcurrentInstances(t *testing.T) {
+	errs := make(chan error, 2)
+	for _, timeout := range []time.Duration{time.Second, 2 * time.Second} {
+		go func(timeout time.Duration) {
+			_, _, err := MeasureLatency(echoServerAddrWs, "Hello, world!", http.Header{},
+				WithDialTimeout(timeout), WithTLSConfig(&tls.Config{}))
+			errs <- err
+		}(timeout)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("Unix sockets not supported: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(wstest.EchoHandler)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	u, _ := url.Parse("ws://sidecar.local/echo")
+	result, response, err := MeasureLatency(u, "Hello, socket!", http.Header{}, WithUnixSocket(path))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(response) != "Hello, socket!" {
+		t.Errorf("Unexpected response: %s", response)
+	}
+	if result.Transport != TransportUnix || result.Applicable(PhaseDNS) || result.Applicable(PhaseTCP) {
+		t.Errorf("Expected DNS and TCP to not apply to transport %q", result.Transport)
+	}
+	if result.WSHandshake <= 0 || result.IPs != nil {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "DNS lookup:      n/a") {
+		t.Errorf("Expected DNS lookup shown as not applicable:\n%s", out)
+	}
+	if out := fmt.Sprintf("%s", result); !strings.HasPrefix(out, "DNSLookup: n/a, TCPConnection: n/a") {
+		t.Errorf("Expected DNS lookup and TCP connection shown as not applicable: %s", out)
+	}
+	data, _ := json.Marshal(result)
+	if strings.Contains(string(data), `"dns_lookup"`) || !strings.Contains(string(data), `"transport":"unix"`) {
+		t.Errorf("Expected no DNS lookup duration in %s", data)
+	}
+}
+
+func TestWithUnixSocketError(t *testing.T) {
+	u, _ := url.Parse("ws://sidecar.local/echo")
+	result, err := MeasureLatencyPing(u, http.Header{}, WithUnixSocket(filepath.Join(t.TempDir(), "missing.sock")))
+	if ErrorPhase(err) != PhaseTCP || result.FailedPhase != PhaseTCP {
+		t.Fatalf("Expected TCP phase error, got %v", err)
+	}
+	// The failed connect phase applies, the DNS lookup still does not
+	if !result.Applicable(PhaseTCP) || result.Applicable(PhaseDNS) {
+		t.Errorf("Expected only the TCP phase to apply to the failed transport %q", result.Transport)
+	}
+	if out := fmt.Sprintf("%s", result); !strings.HasPrefix(out, "DNSLookup: n/a, TCPConnection: 0 ms") {
+		t.Errorf("Expected the TCP connection shown as failed: %s", out)
+	}
+}
+
+func TestWithConn(t *testing.T) {
+	conn, err := net.Dial("tcp", echoServerAddrWs.Host)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	ws := NewWSStat(WithConn(conn))
+	if err := ws.DialContext(context.Background(), echoServerAddrWs, http.Header{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.CloseConn()
+	if ws.Result.Transport != TransportCustom || ws.Result.RemoteAddr != conn.RemoteAddr().String() {
+		t.Errorf("Unexpected transport %q to %s", ws.Result.Transport, ws.Result.RemoteAddr)
+	}
+
+	if err := NewWSStat(WithDialFunc(func(context.Context, string, string) (net.Conn, error) {
+		return nil, io.ErrClosedPipe
+	})).Dial(echoServerAddrWs, http.Header{}); ErrorPhase(err) != PhaseTCP {
+		t.Errorf("Expected TCP phase error from the dial function, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package otelwsstat emits OpenTelemetry traces of wsstat measurements.
+//
+// Each measurement is recorded as one span, with a child span for every phase of the
+// connection: DNS lookup, TCP connect, proxy connect, TLS handshake, WebSocket upgrade, message round trip
+// and close. The child spans use the cumulative durations of wsstat.Result as boundaries,
+// so they line up exactly with the timings wsstat reports.
+package otelwsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relaytools/go-wsstat"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package as the source of the spans.
+const instrumentationName = "github.com/relaytools/go-wsstat/otelwsstat"
+
+// Tracer records wsstat measurements as spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer creating spans with the given provider,
+// or with the global provider if tp is nil.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// MeasureLatency runs wsstat.MeasureLatencyContext and records the measurement as spans
+// under the span in ctx, if any.
+func (t *Tracer) MeasureLatency(ctx context.Context, url *url.URL, msg string, customHeaders http.Header, opts ...wsstat.Option) (wsstat.Result, []byte, error) {
+	result, p, err := wsstat.MeasureLatencyContext(ctx, url, msg, customHeaders, opts...)
+	t.Record(ctx, result, err)
+	return result, p, err
+}
+
+// MeasureLatencyJSON runs wsstat.MeasureLatencyJSONContext and records the measurement as spans
+// under the span in ctx, if any.
+func (t *Tracer) MeasureLatencyJSON(ctx context.Context, url *url.URL, v interface{}, customHeaders http.Header, opts ...wsstat.Option) (wsstat.Result, interface{}, error) {
+	result, p, err := wsstat.MeasureLatencyJSONContext(ctx, url, v, customHeaders, opts...)
+	t.Record(ctx, result, err)
+	return result, p, err
+}
+
+// MeasureLatencyPing runs wsstat.MeasureLatencyPingContext and records the measurement as spans
+// under the span in ctx, if any.
+func (t *Tracer) MeasureLatencyPing(ctx context.Context, url *url.URL, customHeaders http.Header, opts ...wsstat.Option) (wsstat.Result, error) {
+	result, err := wsstat.MeasureLatencyPingContext(ctx, url, customHeaders, opts...)
+	t.Record(ctx, result, err)
+	return result, err
+}
+
+// phaseSpan describes the child span of a phase, as offsets from Result.Start.
+type phaseSpan struct {
+	name  string
+	start time.Duration
+	end   time.Duration
+}
+
+// Record emits the spans of a finished measurement. err is the error returned by the measurement;
+// the span of the failing phase ends when Record is called, as the failure time is not recorded.
+// Results without a start time, from measurements that never dialed, are skipped.
+func (t *Tracer) Record(ctx context.Context, result wsstat.Result, err error) {
+	if result.Start.IsZero() {
+		return
+	}
+	now := time.Now()
+	end := now
+	if err == nil && result.TotalTime > 0 {
+		end = result.Start.Add(result.TotalTime)
+	}
+
+	ctx, span := t.tracer.Start(ctx, "wsstat.measurement",
+		trace.WithTimestamp(result.Start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes(result)...),
+	)
+
+	var phases []phaseSpan
+	add := func(name string, start, end time.Duration, done bool) {
+		if done {
+			phases = append(phases, phaseSpan{name, start, end})
+		}
+	}
+	tunnelDone := result.TCPConnected
+	if result.ProxyConnected > 0 {
+		tunnelDone = result.ProxyConnected
+	}
+	tlsDone := tunnelDone
+	if result.TLSHandshakeDone > 0 {
+		tlsDone = result.TLSHandshakeDone
+	}
+	add("dns_lookup", 0, result.DNSLookupDone, result.DNSLookupDone > 0)
+	add("tcp_connect", result.DNSLookupDone, result.TCPConnected, result.TCPConnected > 0)
+	add("proxy_connect", result.TCPConnected, result.ProxyConnected, result.ProxyConnected > 0)
+	add("tls_handshake", tunnelDone, result.TLSHandshakeDone, result.TLSHandshakeDone > 0)
+	add("ws_upgrade", tlsDone, result.WSHandshakeDone, result.WSHandshakeDone > 0)
+	add("message_round_trip", result.WSHandshakeDone, result.FirstMessageResponse, result.FirstMessageResponse > 0)
+	add("close", result.FirstMessageResponse, result.TotalTime, result.TotalTime > 0)
+
+	var last time.Duration
+	for _, p := range phases {
+		_, child := t.tracer.Start(ctx, "wsstat."+p.name, trace.WithTimestamp(result.Start.Add(p.start)))
+		child.End(trace.WithTimestamp(result.Start.Add(p.end)))
+		last = p.end
+	}
+
+	if err != nil {
+		if result.FailedPhase != wsstat.PhaseNone {
+			_, child := t.tracer.Start(ctx, "wsstat."+failedSpanName(result.FailedPhase),
+				trace.WithTimestamp(result.Start.Add(last)))
+			child.RecordError(err)
+			child.SetStatus(codes.Error, err.Error())
+			child.End(trace.WithTimestamp(now))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// failedSpanName returns the name of the child span for a failed phase.
+func failedSpanName(phase wsstat.Phase) string {
+	switch phase {
+	case wsstat.PhaseDNS:
+		return "dns_lookup"
+	case wsstat.PhaseTCP:
+		return "tcp_connect"
+	case wsstat.PhaseProxy:
+		return "proxy_connect"
+	case wsstat.PhaseTLS:
+		return "tls_handshake"
+	case wsstat.PhaseWSUpgrade:
+		return "ws_upgrade"
+	case wsstat.PhaseWrite, wsstat.PhaseRead:
+		return "message_round_trip"
+	case wsstat.PhaseClose:
+		return "close"
+	default:
+		return phase.String()
+	}
+}
+
+// attributes returns the span attributes describing the measured connection.
+func attributes(result wsstat.Result) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("url.full", result.URL.String()),
+		attribute.String("server.address", result.URL.Hostname()),
+		attribute.StringSlice("wsstat.resolved_ips", result.IPs),
+	}
+	if port, err := strconv.Atoi(wsstat.Port(result.URL)); err == nil {
+		attrs = append(attrs, attribute.Int("server.port", port))
+	}
+	if host, port, err := net.SplitHostPort(result.RemoteAddr); err == nil {
+		attrs = append(attrs, attribute.String("network.peer.address", host))
+		if port, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, attribute.Int("network.peer.port", port))
+		}
+	}
+	if result.DNS != nil {
+		attrs = append(attrs, attribute.String("wsstat.dns.resolver", result.DNS.Resolver))
+		if len(result.DNS.CNAMEs) > 0 {
+			attrs = append(attrs, attribute.StringSlice("wsstat.dns.cnames", result.DNS.CNAMEs))
+		}
+	}
+	if result.StatusCode != 0 {
+		attrs = append(attrs, attribute.Int("http.response.status_code", result.StatusCode))
+	}
+	if result.Subprotocol != "" {
+		attrs = append(attrs, attribute.String("websocket.subprotocol", result.Subprotocol))
+	}
+	if result.TLSState != nil {
+		attrs = append(attrs,
+			attribute.String("tls.protocol.name", "tls"),
+			attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(result.TLSState.Version), "TLS ")),
+			attribute.String("tls.cipher", tls.CipherSuiteName(result.TLSState.CipherSuite)),
+		)
+	}
+	if result.FailedPhase != wsstat.PhaseNone {
+		attrs = append(attrs, attribute.String("wsstat.failed_phase", result.FailedPhase.String()))
+	}
+	return attrs
+}
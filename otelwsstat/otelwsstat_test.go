@@ -0,0 +1,98 @@
+package otelwsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/relaytools/go-wsstat"
+	"github.com/relaytools/go-wsstat/internal/wstest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestTracer returns a Tracer recording spans in memory.
+func newTestTracer() (*Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))), recorder
+}
+
+func TestMeasureLatencySpans(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	_, _, err := tracer.MeasureLatency(context.Background(), wstest.NewTLSEchoServer(t), "Hello, world!", http.Header{},
+		wsstat.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	names := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans {
+		names[span.Name()] = span
+	}
+	root, ok := names["wsstat.measurement"]
+	if !ok {
+		t.Fatalf("Expected measurement span, got %d spans", len(spans))
+	}
+	for _, name := range []string{"dns_lookup", "tcp_connect", "tls_handshake", "ws_upgrade", "message_round_trip", "close"} {
+		child, ok := names["wsstat."+name]
+		if !ok {
+			t.Errorf("Expected %s span", name)
+			continue
+		}
+		if child.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Expected %s span to be a child of the measurement span", name)
+		}
+		if child.StartTime().Before(root.StartTime()) || child.EndTime().After(root.EndTime()) {
+			t.Errorf("Expected %s span within the measurement span", name)
+		}
+	}
+	if names["wsstat.tcp_connect"].StartTime() != names["wsstat.dns_lookup"].EndTime() {
+		t.Error("Expected TCP connect to start when the DNS lookup ends")
+	}
+
+	attrs := attribute.NewSet(root.Attributes()...)
+	for _, key := range []attribute.Key{"wsstat.resolved_ips", "network.peer.address", "wsstat.dns.resolver", "tls.protocol.version", "tls.cipher", "http.response.status_code"} {
+		if !attrs.HasValue(key) {
+			t.Errorf("Expected attribute %s", key)
+		}
+	}
+	if status, _ := attrs.Value("http.response.status_code"); status.AsInt64() != http.StatusSwitchingProtocols {
+		t.Errorf("Unexpected status code: %v", status.AsInt64())
+	}
+}
+
+func TestMeasureLatencyFailureSpans(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedURL, _ := url.Parse("ws://" + listener.Addr().String())
+	listener.Close()
+
+	tracer, recorder := newTestTracer()
+	if _, err := tracer.MeasureLatencyPing(context.Background(), closedURL, http.Header{}); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	var failed sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "wsstat.measurement" && span.Status().Code != codes.Error {
+			t.Error("Expected error status on the measurement span")
+		}
+		if span.Name() == "wsstat.tcp_connect" {
+			failed = span
+		}
+	}
+	if failed == nil {
+		t.Fatal("Expected span for the failed TCP connect")
+	}
+	if failed.Status().Code != codes.Error {
+		t.Errorf("Expected error status on the failed phase span, got %v", failed.Status())
+	}
+}
@@ -0,0 +1,188 @@
+package wsstat
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// startSOCKS5Proxy starts a SOCKS5 proxy requiring the given credentials, and returns its address.
+// The hosts clients asked to connect to, names or IP addresses as received, are sent on hosts.
+func startSOCKS5Proxy(t *testing.T, username, password string, hosts chan<- string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, username, password, hosts)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// serveSOCKS5 handles one SOCKS5 client, supporting only username/password authentication
+// and CONNECT requests to host names or IPv4 addresses.
+func serveSOCKS5(conn net.Conn, username, password string, hosts chan<- string) {
+	defer conn.Close()
+	buf := make([]byte, 512)
+	// Greeting: version, methods
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{0x05, 0x02})
+
+	// Username/password authentication
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	user := make([]byte, buf[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, buf[:1])
+	pass := make([]byte, buf[0])
+	io.ReadFull(conn, pass)
+	if string(user) != username || string(pass) != password {
+		conn.Write([]byte{0x01, 0x01})
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	// CONNECT request to a host name or IPv4 address
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 0x01:
+		ip := make(net.IP, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = ip.String()
+	case 0x03:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		conn.Write([]byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	io.ReadFull(conn, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+	hosts <- host
+
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	hosts := make(chan string, 2)
+	addr := startSOCKS5Proxy(t, "user", "secret", hosts)
+
+	proxyURL, _ := url.Parse("socks5h://user:secret@" + addr)
+	result, response, err := MeasureLatency(echoServerAddrWs, "Hello, SOCKS!", http.Header{}, WithProxy(proxyURL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(response) != "Hello, SOCKS!" {
+		t.Errorf("Unexpected response: %s", response)
+	}
+	if host := <-hosts; host != "localhost" {
+		t.Errorf("Expected the proxy to resolve localhost, got %s", host)
+	}
+	if result.ProxyConnect <= 0 || result.ProxyConnected != result.TCPConnected+result.ProxyConnect {
+		t.Errorf("Invalid proxy timing: %v, connected at %v", result.ProxyConnect, result.ProxyConnected)
+	}
+	if result.WSHandshakeDone != result.ProxyConnected+result.WSHandshake {
+		t.Errorf("Expected the WS handshake to start when the tunnel is open")
+	}
+
+	// socks5 resolves the host locally, with the configured resolver, and sends the address
+	proxyURL, _ = url.Parse("socks5://user:secret@" + addr)
+	target, _ := url.Parse("ws://echo.test:8080/echo")
+	result, _, err = MeasureLatency(target, "Hello, SOCKS!", http.Header{}, WithProxy(proxyURL), WithResolver(startDNSServers(t)["udp"]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if host := <-hosts; host != "127.0.0.1" {
+		t.Errorf("Expected the proxy to be sent the resolved address, got %s", host)
+	}
+	if result.DNSLookup <= 0 || result.RemoteAddr != addr {
+		t.Errorf("Expected the connection to the proxy, got %s after a DNS lookup of %v", result.RemoteAddr, result.DNSLookup)
+	}
+
+	target, _ = url.Parse("ws://missing.test:8080/echo")
+	if _, _, err = MeasureLatency(target, "Hello, SOCKS!", http.Header{}, WithProxy(proxyURL), WithResolver(startDNSServers(t)["udp"])); ErrorPhase(err) != PhaseDNS {
+		t.Errorf("Expected DNS phase error, got %v", err)
+	}
+
+	proxyURL, _ = url.Parse("socks5://user:wrong@" + addr)
+	result, _, err = MeasureLatency(echoServerAddrWs, "Hello, SOCKS!", http.Header{}, WithProxy(proxyURL))
+	if ErrorPhase(err) != PhaseProxy || result.FailedPhase != PhaseProxy {
+		t.Errorf("Expected proxy phase error, got %v", err)
+	}
+}
+
+func TestHTTPProxyAuth(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := parseProxyAuth(r); !ok || username != "user" || password != "secret" {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	if _, err := MeasureLatencyPing(echoServerAddrWs, http.Header{}, WithProxy(proxyURL)); ErrorPhase(err) != PhaseProxy {
+		t.Errorf("Expected proxy phase error without credentials, got %v", err)
+	}
+
+	proxyURL.User = url.UserPassword("user", "secret")
+	result, err := MeasureLatencyPing(echoServerAddrWs, http.Header{}, WithProxy(proxyURL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ProxyConnect <= 0 {
+		t.Errorf("Invalid proxy connect time: %v", result.ProxyConnect)
+	}
+}
+
+// parseProxyAuth returns the basic authentication credentials of a proxy request.
+func parseProxyAuth(r *http.Request) (username, password string, ok bool) {
+	r.Header.Set("Authorization", r.Header.Get("Proxy-Authorization"))
+	return r.BasicAuth()
+}
@@ -0,0 +1,352 @@
+package wsstat
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// defaultDNSTimeout bounds a DNS exchange when the context has no deadline.
+const defaultDNSTimeout = 5 * time.Second
+
+// Resolver resolves the host name of a measurement, see WithResolver.
+type Resolver interface {
+	// Resolve returns the addresses of host. network is "ip4", "ip6" or "ip" for both families.
+	// The addresses are in order of preference, which decides the family WithHappyEyeballs tries first.
+	Resolve(ctx context.Context, network, host string) (*DNSAnswer, error)
+}
+
+// DNSAnswer is the answer of a Resolver.
+type DNSAnswer struct {
+	Resolver string    // Resolver that answered, e.g. "system" or "udp://1.1.1.1:53"
+	Addrs    []DNSAddr // Addresses the host resolved to
+	CNAMEs   []string  // Canonical names the host was aliased through, in chain order
+}
+
+// DNSAddr is a resolved address with its time to live.
+type DNSAddr struct {
+	IP  net.IP
+	TTL time.Duration // Zero if the resolver does not report TTLs
+}
+
+// resolve resolves host with the configured resolver, in the address family of the configured
+// network. An answer without addresses, which a custom Resolver may return, fails as not found.
+func (c *config) resolve(ctx context.Context, host string) (*DNSAnswer, error) {
+	answer, err := c.resolver.Resolve(ctx, lookupNetwork(c.network), host)
+	if err != nil {
+		return nil, err
+	}
+	if answer == nil || len(answer.Addrs) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+	}
+	return answer, nil
+}
+
+// systemResolver resolves with net.DefaultResolver, which reports neither TTLs nor CNAME chains.
+type systemResolver struct{}
+
+// Resolve looks up host with net.DefaultResolver.
+func (systemResolver) Resolve(ctx context.Context, network, host string) (*DNSAnswer, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	answer := &DNSAnswer{Resolver: "system", Addrs: make([]DNSAddr, len(ips))}
+	for i, ip := range ips {
+		answer.Addrs[i] = DNSAddr{IP: ip}
+	}
+	return answer, nil
+}
+
+// dnsResolver sends DNS queries itself, over one of the supported transports.
+type dnsResolver struct {
+	name     string
+	exchange func(ctx context.Context, query []byte) ([]byte, error)
+}
+
+// NewDNSResolver returns a Resolver querying the DNS server at addr over network, "udp" or "tcp".
+// The port of addr defaults to 53. UDP answers that are truncated are retried over TCP.
+func NewDNSResolver(network, addr string) Resolver {
+	addr = withDefaultPort(addr, "53")
+	return &dnsResolver{
+		name: network + "://" + addr,
+		exchange: func(ctx context.Context, query []byte) ([]byte, error) {
+			if network != "udp" {
+				return exchangeStream(ctx, network, addr, nil, query)
+			}
+			response, err := exchangeUDP(ctx, addr, query)
+			if err == nil && truncated(response) {
+				return exchangeStream(ctx, "tcp", addr, nil, query)
+			}
+			return response, err
+		},
+	}
+}
+
+// NewDoTResolver returns a Resolver querying the DNS-over-TLS server at addr, per RFC 7858.
+// The port of addr defaults to 853. If tlsConfig is nil or has no ServerName, the host of addr
+// is verified.
+func NewDoTResolver(addr string, tlsConfig *tls.Config) Resolver {
+	addr = withDefaultPort(addr, "853")
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	return &dnsResolver{
+		name: "tls://" + addr,
+		exchange: func(ctx context.Context, query []byte) ([]byte, error) {
+			return exchangeStream(ctx, "tcp", addr, tlsConfig, query)
+		},
+	}
+}
+
+// NewDoHResolver returns a Resolver querying the DNS-over-HTTPS endpoint at url, such as
+// "https://cloudflare-dns.com/dns-query", with POST requests per RFC 8484.
+// If client is nil, http.DefaultClient is used.
+func NewDoHResolver(url string, client *http.Client) Resolver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &dnsResolver{
+		name: url,
+		exchange: func(ctx context.Context, query []byte) ([]byte, error) {
+			// RFC 8484 recommends an ID of 0 for cache friendliness
+			query[0], query[1] = 0, 0
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/dns-message")
+			req.Header.Set("Accept", "application/dns-message")
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("DNS-over-HTTPS server returned %s", resp.Status)
+			}
+			return io.ReadAll(io.LimitReader(resp.Body, 65535))
+		},
+	}
+}
+
+// Resolve queries the A and AAAA records of host, as selected by network, in parallel.
+// IPv6 addresses are returned before IPv4 addresses. A literal IP address is returned as is,
+// if it is of the family selected by network.
+func (r *dnsResolver) Resolve(ctx context.Context, network, host string) (*DNSAnswer, error) {
+	answer := &DNSAnswer{Resolver: r.name}
+	if ip := net.ParseIP(host); ip != nil {
+		if (network == "ip4" && ip.To4() == nil) || (network == "ip6" && ip.To4() != nil) {
+			return nil, &net.DNSError{Err: "no suitable address found", Name: host, Server: r.name, IsNotFound: true}
+		}
+		answer.Addrs = []DNSAddr{{IP: ip}}
+		return answer, nil
+	}
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, Server: r.name}
+	}
+
+	// IPv6 addresses come first, as RFC 6724 prefers them, so that WithHappyEyeballs gives IPv6
+	// the head start of RFC 8305
+	var types []dnsmessage.Type
+	if network != "ip4" {
+		types = append(types, dnsmessage.TypeAAAA)
+	}
+	if network != "ip6" {
+		types = append(types, dnsmessage.TypeA)
+	}
+	answers := make([]*DNSAnswer, len(types))
+	errs := make([]error, len(types))
+	var wg sync.WaitGroup
+	for i, qtype := range types {
+		wg.Add(1)
+		go func(i int, qtype dnsmessage.Type) {
+			defer wg.Done()
+			answers[i], errs[i] = r.query(ctx, name, qtype)
+		}(i, qtype)
+	}
+	wg.Wait()
+
+	// A failed query of one family does not discard the addresses of the other
+	var firstErr error
+	for i := range types {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		answer.Addrs = append(answer.Addrs, answers[i].Addrs...)
+		if len(answers[i].CNAMEs) > len(answer.CNAMEs) {
+			answer.CNAMEs = answers[i].CNAMEs
+		}
+	}
+	if len(answer.Addrs) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host, Server: r.name, IsNotFound: true}
+	}
+	return answer, nil
+}
+
+// query exchanges a query for the records of type qtype of name.
+func (r *dnsResolver) query(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) (*DNSAnswer, error) {
+	var id [2]byte
+	rand.Read(id[:])
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultDNSTimeout)
+		defer cancel()
+	}
+	response, err := r.exchange(ctx, query)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name.String(), Server: r.name, IsTimeout: isTimeout(err)}
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(response); err != nil {
+		return nil, &net.DNSError{Err: "invalid DNS response: " + err.Error(), Name: name.String(), Server: r.name}
+	}
+	if reply.ID != binary.BigEndian.Uint16(query[:2]) {
+		return nil, &net.DNSError{Err: "DNS response ID mismatch", Name: name.String(), Server: r.name}
+	}
+	switch reply.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: strings.TrimSuffix(name.String(), "."), Server: r.name, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: "server returned " + reply.RCode.String(), Name: name.String(), Server: r.name}
+	}
+
+	answer := &DNSAnswer{}
+	for _, rr := range reply.Answers {
+		ttl := time.Duration(rr.Header.TTL) * time.Second
+		switch body := rr.Body.(type) {
+		case *dnsmessage.CNAMEResource:
+			answer.CNAMEs = append(answer.CNAMEs, strings.TrimSuffix(body.CNAME.String(), "."))
+		case *dnsmessage.AResource:
+			answer.Addrs = append(answer.Addrs, DNSAddr{IP: net.IP(body.A[:]), TTL: ttl})
+		case *dnsmessage.AAAAResource:
+			answer.Addrs = append(answer.Addrs, DNSAddr{IP: net.IP(body.AAAA[:]), TTL: ttl})
+		}
+	}
+	return answer, nil
+}
+
+// exchangeUDP sends query to addr over UDP and returns the response.
+func exchangeUDP(ctx context.Context, addr string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 65535)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		// Ignore stray datagrams that do not answer the query
+		if n >= 2 && bytes.Equal(response[:2], query[:2]) {
+			return response[:n], nil
+		}
+	}
+}
+
+// exchangeStream sends query to addr over a TCP connection, wrapped in TLS if tlsConfig is set,
+// and returns the response. Messages are prefixed with their length, per RFC 1035 and RFC 7858.
+func exchangeStream(ctx context.Context, network, addr string, tlsConfig *tls.Config, query []byte) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, network, addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return response, nil
+}
+
+// truncated reports whether the TC bit of a DNS response is set.
+func truncated(response []byte) bool {
+	return len(response) > 2 && response[2]&0x02 != 0
+}
+
+// isTimeout reports whether err is a timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// dnsName returns host as a fully qualified domain name.
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// withDefaultPort returns addr with port appended if it has none.
+func withDefaultPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	return addr
+}
@@ -0,0 +1,244 @@
+package wsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsReply answers a query for echo.test with a CNAME to edge.test, which has the A record
+// 127.0.0.1 with a TTL of 300s. dual.test has the A record 127.0.0.1 and the AAAA record ::1,
+// and AAAA queries for broken6.test fail. Any other name is answered with NXDOMAIN.
+func dnsReply(t *testing.T, query []byte) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		t.Errorf("Invalid query: %v", err)
+		return nil
+	}
+	q := msg.Questions[0]
+	msg.Header.Response = true
+	switch name := q.Name.String(); {
+	case name == "broken6.test." && q.Type == dnsmessage.TypeAAAA:
+		msg.Header.RCode = dnsmessage.RCodeServerFailure
+	case name == "dual.test." || name == "broken6.test.":
+		if q.Type == dnsmessage.TypeA {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			})
+		} else if q.Type == dnsmessage.TypeAAAA {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}},
+			})
+		}
+	case name != "echo.test.":
+		msg.Header.RCode = dnsmessage.RCodeNameError
+	default:
+		edge := dnsmessage.MustNewName("edge.test.")
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.CNAMEResource{CNAME: edge},
+		})
+		if q.Type == dnsmessage.TypeA {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: edge, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			})
+		}
+	}
+	reply, err := msg.Pack()
+	if err != nil {
+		t.Errorf("Failed to pack reply: %v", err)
+	}
+	return reply
+}
+
+// serveDNSStream answers length-prefixed DNS queries on the connections accepted by listener.
+func serveDNSStream(t *testing.T, listener net.Listener) {
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var length [2]byte
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(length[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					reply := dnsReply(t, query)
+					binary.BigEndian.PutUint16(length[:], uint16(len(reply)))
+					conn.Write(append(length[:], reply...))
+				}
+			}()
+		}
+	}()
+}
+
+// startDNSServers starts a DNS server over UDP, TCP, TLS and HTTPS, and returns resolvers for each.
+func startDNSServers(t *testing.T) map[string]Resolver {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { packetConn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := packetConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			packetConn.WriteTo(dnsReply(t, buf[:n]), addr)
+		}
+	}()
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveDNSStream(t, tcpListener)
+
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsReply(t, query))
+	}))
+	t.Cleanup(doh.Close)
+
+	dotListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveDNSStream(t, tls.NewListener(dotListener, doh.TLS))
+	roots := x509.NewCertPool()
+	roots.AddCert(doh.Certificate())
+
+	return map[string]Resolver{
+		"udp": NewDNSResolver("udp", packetConn.LocalAddr().String()),
+		"tcp": NewDNSResolver("tcp", tcpListener.Addr().String()),
+		"dot": NewDoTResolver(dotListener.Addr().String(), &tls.Config{RootCAs: roots}),
+		"doh": NewDoHResolver(doh.URL, doh.Client()),
+	}
+}
+
+func TestResolvers(t *testing.T) {
+	for name, resolver := range startDNSServers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			answer, err := resolver.Resolve(ctx, "ip", "echo.test")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(answer.Addrs) != 1 || !answer.Addrs[0].IP.Equal(net.IPv4(127, 0, 0, 1)) || answer.Addrs[0].TTL != 300*time.Second {
+				t.Errorf("Unexpected addresses: %+v", answer.Addrs)
+			}
+			if len(answer.CNAMEs) != 1 || answer.CNAMEs[0] != "edge.test" {
+				t.Errorf("Unexpected CNAME chain: %v", answer.CNAMEs)
+			}
+
+			_, err = resolver.Resolve(ctx, "ip", "missing.test")
+			if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+				t.Errorf("Expected not found error, got %v", err)
+			}
+			if _, err := resolver.Resolve(ctx, "ip6", "echo.test"); err == nil {
+				t.Error("Expected error for a host without IPv6 addresses")
+			}
+
+			// IPv6 first, and the IPv4 addresses despite a failed AAAA query
+			answer, err = resolver.Resolve(ctx, "ip", "dual.test")
+			if err != nil || len(answer.Addrs) != 2 || answer.Addrs[0].IP.To4() != nil || answer.Addrs[1].IP.To4() == nil {
+				t.Errorf("Expected the IPv6 address first, got %+v: %v", answer, err)
+			}
+			answer, err = resolver.Resolve(ctx, "ip", "broken6.test")
+			if err != nil || len(answer.Addrs) != 1 || !answer.Addrs[0].IP.Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Errorf("Expected the IPv4 address, got %+v: %v", answer, err)
+			}
+			if _, err := resolver.Resolve(ctx, "ip6", "broken6.test"); err == nil {
+				t.Error("Expected error for a failed AAAA query")
+			}
+
+			// Literal addresses of the requested family only
+			if answer, err := resolver.Resolve(ctx, "ip6", "::1"); err != nil || len(answer.Addrs) != 1 {
+				t.Errorf("Expected the IPv6 literal, got %+v: %v", answer, err)
+			}
+			if _, err := resolver.Resolve(ctx, "ip6", "127.0.0.1"); err == nil {
+				t.Error("Expected error for an IPv4 literal under ip6")
+			}
+			if _, err := resolver.Resolve(ctx, "ip4", "::1"); err == nil {
+				t.Error("Expected error for an IPv6 literal under ip4")
+			}
+		})
+	}
+}
+
+func TestWithResolver(t *testing.T) {
+	resolver := startDNSServers(t)["udp"]
+	u, _ := url.Parse("ws://echo.test:8080/echo")
+	result, err := MeasureLatencyPing(u, http.Header{}, WithResolver(resolver))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.DNS == nil || result.DNS.Resolver != resolver.(*dnsResolver).name {
+		t.Fatalf("Expected the answer of the configured resolver, got %+v", result.DNS)
+	}
+	if result.RemoteAddr != "127.0.0.1:8080" {
+		t.Errorf("Unexpected remote address: %s", result.RemoteAddr)
+	}
+
+	u, _ = url.Parse("ws://missing.test:8080/echo")
+	if _, err := MeasureLatencyPing(u, http.Header{}, WithResolver(resolver)); ErrorPhase(err) != PhaseDNS {
+		t.Errorf("Expected DNS phase error, got %v", err)
+	}
+}
+
+// emptyResolver answers without addresses, with a nil answer if nilAnswer is set.
+type emptyResolver struct{ nilAnswer bool }
+
+func (r emptyResolver) Resolve(ctx context.Context, network, host string) (*DNSAnswer, error) {
+	if r.nilAnswer {
+		return nil, nil
+	}
+	return &DNSAnswer{Resolver: "empty"}, nil
+}
+
+func TestEmptyResolverAnswer(t *testing.T) {
+	u, _ := url.Parse("ws://echo.test:8080/echo")
+	for _, resolver := range []Resolver{emptyResolver{}, emptyResolver{nilAnswer: true}} {
+		_, err := MeasureLatencyPing(u, http.Header{}, WithResolver(resolver))
+		if dnsErr := new(net.DNSError); ErrorPhase(err) != PhaseDNS || !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("Expected not found error in the DNS phase, got %v", err)
+		}
+		_, err = MeasureAllAddresses(context.Background(), u, func(ctx context.Context, opts ...Option) (Result, error) {
+			t.Error("Unexpected measurement")
+			return Result{}, nil
+		}, WithResolver(resolver))
+		if ErrorPhase(err) != PhaseDNS {
+			t.Errorf("Expected DNS phase error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package wsstat
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Resumption compares a full TLS handshake with a handshake resuming its session, see MeasureResumption.
+type Resumption struct {
+	Initial   Result        // Measurement with a full TLS handshake
+	Resumed   Result        // Measurement that offered the session of the initial connection
+	DidResume bool          // Whether the server accepted the session, from Resumed.TLSState.DidResume
+	Saving    time.Duration // TLS handshake time saved by resuming, negative if resuming was slower
+}
+
+// MeasureResumption measures whether the server at url resumes TLS sessions, and how much
+// handshake time it saves. It connects and sends a ping, which gives the server the chance
+// to issue a session ticket, closes the connection, then does the same again with a session
+// cache shared between both connections.
+// If the TLS configuration set by opts has a ClientSessionCache, it is used as the shared cache.
+// 0-RTT early data is not measured, as crypto/tls does not support it.
+func MeasureResumption(ctx context.Context, url *url.URL, customHeaders http.Header, opts ...Option) (Resumption, error) {
+	if url.Scheme != "wss" {
+		return Resumption{}, errors.New("session resumption requires a wss:// URL")
+	}
+	tlsConfig := &tls.Config{}
+	if cfg := newConfig(opts...); cfg.tlsConfig != nil {
+		tlsConfig = cfg.tlsConfig.Clone()
+	}
+	if tlsConfig.ClientSessionCache == nil {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	}
+	opts = append(opts[:len(opts):len(opts)], WithTLSConfig(tlsConfig))
+
+	var r Resumption
+	var err error
+	if r.Initial, err = MeasureLatencyPingContext(ctx, url, customHeaders, opts...); err != nil {
+		return r, err
+	}
+	if r.Resumed, err = MeasureLatencyPingContext(ctx, url, customHeaders, opts...); err != nil {
+		return r, err
+	}
+	r.DidResume = r.Resumed.TLSState != nil && r.Resumed.TLSState.DidResume
+	r.Saving = r.Initial.TLSHandshake - r.Resumed.TLSHandshake
+	return r, nil
+}
@@ -0,0 +1,46 @@
+package wsstat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+func TestMeasureResumption(t *testing.T) {
+	server, tlsConfig := wstest.StartTLSEchoServer(t)
+	r, err := MeasureResumption(context.Background(), wsURL(t, server, "/echo"), http.Header{}, WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.Initial.TLSState.DidResume {
+		t.Error("Expected a full handshake on the initial connection")
+	}
+	if !r.DidResume {
+		t.Error("Expected the second connection to resume the session")
+	}
+	if r.Saving != r.Initial.TLSHandshake-r.Resumed.TLSHandshake {
+		t.Errorf("Unexpected saving: %v", r.Saving)
+	}
+	if tlsConfig.ClientSessionCache != nil {
+		t.Error("Expected the caller's TLS configuration to be left unchanged")
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Failed to marshal resumption: %v", err)
+	}
+	var decoded Resumption
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal resumption: %v", err)
+	}
+	if !decoded.DidResume || decoded.Saving != r.Saving || !decoded.Resumed.TLSState.DidResume {
+		t.Errorf("Unexpected decoded resumption: %s", data)
+	}
+
+	if _, err := MeasureResumption(context.Background(), echoServerAddrWs, http.Header{}); err == nil {
+		t.Error("Expected error for a ws:// URL")
+	}
+}
@@ -0,0 +1,158 @@
+package wsstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Sampler describes a series of round trips over a single connection.
+type Sampler struct {
+	Count       int           // Number of round trips to measure
+	Interval    time.Duration // Pause between the end of one round trip and the start of the next
+	MessageType int           // websocket.TextMessage, websocket.BinaryMessage or websocket.PingMessage
+	Payload     []byte        // Message to send, ignored for pings
+}
+
+// LatencyStats summarizes a series of round-trip times.
+type LatencyStats struct {
+	Samples []time.Duration // Round-trip time of each message, in the order sent
+
+	Min    time.Duration // Fastest round trip
+	Max    time.Duration // Slowest round trip
+	Mean   time.Duration // Arithmetic mean
+	StdDev time.Duration // Population standard deviation
+	P50    time.Duration // Median
+	P90    time.Duration // 90th percentile
+	P99    time.Duration // 99th percentile
+	Jitter time.Duration // Mean absolute difference between consecutive round trips
+}
+
+// Sample measures s.Count round trips over the established connection, pausing s.Interval between them.
+// The statistics are stored in Result.Stats, replacing those of an earlier call, and returned.
+// If a round trip fails, the statistics cover the samples taken so far and the error is returned
+// alongside them.
+// Sets result times: MessageRoundTrip, FirstMessageResponse (from the first round trip)
+func (ws *WSStat) Sample(ctx context.Context, s Sampler) (*LatencyStats, error) {
+	ws.Result.Stats = nil
+	if s.Count < 1 {
+		return nil, errors.New("sample count must be at least 1")
+	}
+	switch s.MessageType {
+	case websocket.TextMessage, websocket.BinaryMessage, websocket.PingMessage:
+	default:
+		return nil, fmt.Errorf("unsupported sample message type %d", s.MessageType)
+	}
+
+	samples := make([]time.Duration, 0, s.Count)
+	var err error
+	for i := 0; i < s.Count; i++ {
+		if i > 0 && s.Interval > 0 {
+			timer := time.NewTimer(s.Interval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				err = ws.fail(PhaseWrite, ctx.Err())
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		if s.MessageType == websocket.PingMessage {
+			err = ws.SendPingContext(ctx)
+		} else {
+			_, err = ws.SendMessageContext(ctx, s.MessageType, s.Payload)
+		}
+		if err != nil {
+			break
+		}
+		samples = append(samples, ws.Result.MessageRoundTrip)
+	}
+
+	if len(samples) > 0 {
+		ws.Result.MessageRoundTrip = samples[0]
+		ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + ws.Result.MessageRoundTrip
+		ws.Result.Stats = NewLatencyStats(samples)
+	}
+	return ws.Result.Stats, err
+}
+
+// NewLatencyStats computes statistics over the given round-trip times.
+// Returns nil if there are no samples.
+func NewLatencyStats(samples []time.Duration) *LatencyStats {
+	if len(samples) == 0 {
+		return nil
+	}
+	stats := &LatencyStats{Samples: append([]time.Duration(nil), samples...)}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.P50 = percentile(sorted, 50)
+	stats.P90 = percentile(sorted, 90)
+	stats.P99 = percentile(sorted, 99)
+
+	var sum float64
+	for _, d := range samples {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(samples))
+	stats.Mean = time.Duration(mean)
+
+	var variance, jitter float64
+	for i, d := range samples {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+		if i > 0 {
+			jitter += math.Abs(float64(d - samples[i-1]))
+		}
+	}
+	stats.StdDev = time.Duration(math.Sqrt(variance / float64(len(samples))))
+	if len(samples) > 1 {
+		stats.Jitter = time.Duration(jitter / float64(len(samples)-1))
+	}
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted samples using the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// MeasureLatencyN establishes a WebSocket connection, measures the round trips described by the
+// Sampler over it, and closes the connection. Returns the Result with Stats set.
+// Sets all times in the Result object.
+func MeasureLatencyN(url *url.URL, s Sampler, customHeaders http.Header, opts ...Option) (Result, error) {
+	return MeasureLatencyNContext(context.Background(), url, s, customHeaders, opts...)
+}
+
+// MeasureLatencyNContext is like MeasureLatencyN but honors the context through every phase
+// of the measurement, from the DNS lookup to the close handshake.
+// On failure the returned Result holds the times of the phases that completed.
+func MeasureLatencyNContext(ctx context.Context, url *url.URL, s Sampler, customHeaders http.Header, opts ...Option) (Result, error) {
+	ws := NewWSStat(opts...)
+	if err := ws.DialContext(ctx, url, customHeaders); err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
+		return *ws.Result, err
+	}
+	if _, err := ws.Sample(ctx, s); err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to sample round trips")
+		ws.conn.Close()
+		return *ws.Result, err
+	}
+	ws.CloseConnContext(ctx)
+	return *ws.Result, nil
+}
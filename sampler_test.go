@@ -0,0 +1,118 @@
+package wsstat
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	stats := NewLatencyStats([]time.Duration{10 * ms, 30 * ms, 20 * ms, 40 * ms})
+
+	if stats.Min != 10*ms || stats.Max != 40*ms {
+		t.Errorf("Unexpected min/max: %v/%v", stats.Min, stats.Max)
+	}
+	if stats.Mean != 25*ms {
+		t.Errorf("Unexpected mean: %v", stats.Mean)
+	}
+	// sqrt(((15^2)+(5^2)+(5^2)+(15^2))/4) ms
+	if stats.StdDev < 11180*time.Microsecond || stats.StdDev > 11181*time.Microsecond {
+		t.Errorf("Unexpected standard deviation: %v", stats.StdDev)
+	}
+	if stats.P50 != 20*ms || stats.P90 != 40*ms || stats.P99 != 40*ms {
+		t.Errorf("Unexpected percentiles: %v/%v/%v", stats.P50, stats.P90, stats.P99)
+	}
+	// (20 + 10 + 20) / 3 ms
+	if stats.Jitter < 16666*time.Microsecond || stats.Jitter > 16667*time.Microsecond {
+		t.Errorf("Unexpected jitter: %v", stats.Jitter)
+	}
+
+	if NewLatencyStats(nil) != nil {
+		t.Error("Expected nil stats without samples")
+	}
+}
+
+func TestMeasureLatencyN(t *testing.T) {
+	sampler := Sampler{
+		Count:       5,
+		Interval:    10 * time.Millisecond,
+		MessageType: websocket.TextMessage,
+		Payload:     []byte("Hello, world!"),
+	}
+	result, err := MeasureLatencyN(echoServerAddrWs, sampler, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Stats == nil {
+		t.Fatal("Expected stats to be set")
+	}
+	if len(result.Stats.Samples) != 5 {
+		t.Errorf("Expected 5 samples, got %d", len(result.Stats.Samples))
+	}
+	if result.Stats.Min <= 0 || result.Stats.Max < result.Stats.Min {
+		t.Errorf("Invalid min/max: %v/%v", result.Stats.Min, result.Stats.Max)
+	}
+	if result.MessageRoundTrip != result.Stats.Samples[0] {
+		t.Errorf("Expected MessageRoundTrip to be the first sample")
+	}
+	if result.WSHandshakeDone <= 0 || result.TotalTime <= 0 {
+		t.Errorf("Expected handshake timings to be set")
+	}
+}
+
+func TestSamplePing(t *testing.T) {
+	ws := NewWSStat()
+	if err := ws.Dial(echoServerAddrWs, http.Header{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stats, err := ws.Sample(context.Background(), Sampler{Count: 3, MessageType: websocket.PingMessage})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats.Samples) != 3 {
+		t.Errorf("Expected 3 samples, got %d", len(stats.Samples))
+	}
+	if err := ws.CloseConn(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSamplePartialFailure(t *testing.T) {
+	ws := NewWSStat(WithReadTimeout(100 * time.Millisecond))
+	if err := ws.Dial(silentServerAddrWs, http.Header{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.conn.Close()
+
+	stats, err := ws.Sample(context.Background(), Sampler{Count: 3, MessageType: websocket.TextMessage})
+	if ErrorPhase(err) != PhaseRead {
+		t.Errorf("Expected read phase error, got: %v", err)
+	}
+	if stats != nil {
+		t.Errorf("Expected no stats without successful samples, got %+v", stats)
+	}
+}
+
+func TestSampleInvalid(t *testing.T) {
+	ws := NewWSStat()
+	if err := ws.Dial(echoServerAddrWs, http.Header{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.CloseConn()
+	if _, err := ws.Sample(context.Background(), Sampler{Count: 2, MessageType: websocket.PingMessage}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A failed call does not return the statistics of the earlier one
+	stats, err := ws.Sample(context.Background(), Sampler{Count: 1})
+	if err == nil {
+		t.Error("Expected an error for a zero message type")
+	}
+	if stats != nil || ws.Result.Stats != nil {
+		t.Errorf("Expected no stats, got %+v", stats)
+	}
+}
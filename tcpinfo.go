@@ -0,0 +1,51 @@
+package wsstat
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// TCPInfo is a snapshot of the kernel's statistics of a TCP connection, see tcp(7).
+// It is only available on Linux.
+type TCPInfo struct {
+	RTT         time.Duration // Smoothed round-trip time
+	RTTVar      time.Duration // Round-trip time variance
+	Retransmits uint32        // Segments retransmitted since the connection was established
+	SndCwnd     uint32        // Congestion window, in segments
+	SndMSS      uint32        // Maximum segment size for sending, in bytes
+}
+
+// tcpConn returns the TCP connection underneath conn and the wrappers of this package and
+// crypto/tls, or nil if conn is not over TCP.
+func tcpConn(conn net.Conn) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case *frameConn:
+			conn = c.Conn
+		case *countingConn:
+			conn = c.Conn
+		case *tls.Conn:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+}
+
+// snapshotTCPInfo returns the kernel's statistics of the TCP connection underneath the WebSocket
+// connection, or nil if they are not available.
+func (ws *WSStat) snapshotTCPInfo() *TCPInfo {
+	conn := tcpConn(ws.conn.NetConn())
+	if conn == nil {
+		return nil
+	}
+	info, err := readTCPInfo(conn)
+	if err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to read TCP_INFO")
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,39 @@
+package wsstat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+func TestTCPInfo(t *testing.T) {
+	server, tlsConfig := wstest.StartTLSEchoServer(t)
+	result, _, err := MeasureLatencyContext(context.Background(), wsURL(t, server, "/echo"), "Hello", http.Header{},
+		WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, info := range map[string]*TCPInfo{"handshake": result.HandshakeTCPInfo, "message": result.MessageTCPInfo} {
+		if info == nil {
+			t.Fatalf("Expected a TCP_INFO snapshot after the %s", name)
+		}
+		if info.RTT <= 0 || info.SndCwnd == 0 || info.SndMSS == 0 {
+			t.Errorf("Unexpected TCP_INFO after the %s: %+v", name, info)
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.MessageTCPInfo == nil || *decoded.MessageTCPInfo != *result.MessageTCPInfo {
+		t.Errorf("Unexpected decoded TCP_INFO: %+v", decoded.MessageTCPInfo)
+	}
+}
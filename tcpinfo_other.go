@@ -0,0 +1,13 @@
+//go:build !linux
+
+package wsstat
+
+import (
+	"errors"
+	"net"
+)
+
+// readTCPInfo reports that TCP_INFO is only supported on Linux.
+func readTCPInfo(*net.TCPConn) (*TCPInfo, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,325 @@
+package wsstat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ByteCount is a number of bytes written to and read from a connection.
+type ByteCount struct {
+	Written int64 // Bytes written
+	Read    int64 // Bytes read
+}
+
+// FrameCount counts the WebSocket frames of a message type.
+type FrameCount struct {
+	Frames int   // Number of frames, continuation frames included
+	Bytes  int64 // Bytes of the frames, headers included, as compressed if permessage-deflate is used
+}
+
+// WireStats counts the bytes on the wire of a connection by phase, and its WebSocket frames by
+// message type. Bytes are counted below TLS, so they include the TLS records; TCP and IP headers
+// are not visible, so the TCP connection phase carries no bytes.
+type WireStats struct {
+	Proxy     ByteCount // Proxy handshake, if a proxy is used
+	TLS       ByteCount // TLS handshake, with the certificate chain
+	WSUpgrade ByteCount // HTTP upgrade request and response, with their headers
+	Messages  ByteCount // Messages, pings and pongs, until the close handshake
+	Close     ByteCount // Close handshake
+
+	Sent     map[string]FrameCount // Frames written, by message type: text, binary, close, ping or pong
+	Received map[string]FrameCount // Frames read, by message type
+}
+
+// formatFrames returns the frame counts as "text 2 (64 B), ping 1 (6 B)", sorted by message type.
+func formatFrames(counts map[string]FrameCount) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	types := make([]string, 0, len(counts))
+	for messageType := range counts {
+		types = append(types, messageType)
+	}
+	sort.Strings(types)
+	parts := make([]string, len(types))
+	for i, messageType := range types {
+		parts[i] = fmt.Sprintf("%s %d (%d B)", messageType, counts[messageType].Frames, counts[messageType].Bytes)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Phases of the wire statistics, in the order they occur.
+const (
+	wireProxy = iota
+	wireTLS
+	wireUpgrade
+	wireMessages
+	wireClose
+	wirePhases
+)
+
+// wireCounter counts the bytes read from and written to the connections of a WSStat,
+// and the WebSocket frames exchanged over them.
+type wireCounter struct {
+	read    atomic.Int64
+	written atomic.Int64
+	ends    [wirePhases]*ByteCount // Totals at the end of each phase, nil for phases not ended
+
+	mu       sync.Mutex
+	sent     map[string]FrameCount
+	received map[string]FrameCount
+}
+
+// wrap returns conn counting its bytes in c. Connections secured with TLS are wrapped below TLS.
+func (c *wireCounter) wrap(conn net.Conn) net.Conn {
+	return &countingConn{Conn: conn, counter: c}
+}
+
+// parseFrames returns conn counting the WebSocket frames read and written through it in c,
+// once the HTTP upgrade is done. Connections secured with TLS are wrapped above TLS.
+func (c *wireCounter) parseFrames(conn net.Conn) net.Conn {
+	return &frameConn{Conn: conn, counter: c}
+}
+
+// totals returns the number of bytes read and written so far.
+func (c *wireCounter) totals() ByteCount {
+	return ByteCount{Written: c.written.Load(), Read: c.read.Load()}
+}
+
+// total returns the number of bytes read and written so far, in both directions.
+func (c *wireCounter) total() int64 {
+	t := c.totals()
+	return t.Written + t.Read
+}
+
+// end records the end of a phase; the bytes that follow belong to the next phase.
+func (c *wireCounter) end(phase int) {
+	t := c.totals()
+	c.ends[phase] = &t
+}
+
+// stats returns the bytes of each phase so far, and the frame counts.
+func (c *wireCounter) stats() WireStats {
+	var phases [wirePhases]ByteCount
+	var start ByteCount
+	next := 0 // Phase the bytes since start belong to
+	for i, end := range c.ends {
+		if end != nil {
+			phases[i] = ByteCount{Written: end.Written - start.Written, Read: end.Read - start.Read}
+			start = *end
+			next = i + 1
+		}
+	}
+	if next < wirePhases {
+		t := c.totals()
+		phases[next] = ByteCount{Written: t.Written - start.Written, Read: t.Read - start.Read}
+	}
+	sent, received := c.frames()
+	return WireStats{
+		Proxy:     phases[wireProxy],
+		TLS:       phases[wireTLS],
+		WSUpgrade: phases[wireUpgrade],
+		Messages:  phases[wireMessages],
+		Close:     phases[wireClose],
+		Sent:      sent,
+		Received:  received,
+	}
+}
+
+// frames returns copies of the frame counts.
+func (c *wireCounter) frames() (sent, received map[string]FrameCount) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clone := func(m map[string]FrameCount) map[string]FrameCount {
+		if m == nil {
+			return nil
+		}
+		out := make(map[string]FrameCount, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out
+	}
+	return clone(c.sent), clone(c.received)
+}
+
+// countFrame records a frame of the given type and size in counts.
+func (c *wireCounter) countFrame(counts *map[string]FrameCount, messageType string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if *counts == nil {
+		*counts = map[string]FrameCount{}
+	}
+	fc := (*counts)[messageType]
+	fc.Frames++
+	fc.Bytes += size
+	(*counts)[messageType] = fc
+}
+
+// countingConn is a net.Conn counting the bytes read and written through it.
+type countingConn struct {
+	net.Conn
+	counter *wireCounter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.counter.read.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.counter.written.Add(int64(n))
+	return n, err
+}
+
+// frameConn is a net.Conn counting the WebSocket frames read and written through it.
+type frameConn struct {
+	net.Conn
+	counter *wireCounter
+	reader  frameParser
+	writer  frameParser
+}
+
+func (c *frameConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.reader.parse(b[:n], func(messageType string, size int64) {
+		c.counter.countFrame(&c.counter.received, messageType, size)
+	})
+	return n, err
+}
+
+func (c *frameConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.writer.parse(b[:n], func(messageType string, size int64) {
+		c.counter.countFrame(&c.counter.sent, messageType, size)
+	})
+	return n, err
+}
+
+// headerEnd ends the HTTP upgrade request and response, after which the frames start.
+const headerEnd = "\r\n\r\n"
+
+// frameParser follows the frame headers in one direction of a WebSocket connection, see RFC 6455 section 5.2.
+type frameParser struct {
+	upgraded  bool   // Whether the HTTP upgrade message has been skipped
+	matched   int    // Bytes of headerEnd matched so far
+	header    []byte // Bytes of the current frame header read so far
+	remaining int64  // Payload bytes of the current frame not read yet
+	message   string // Type of the fragmented message continuation frames belong to
+}
+
+// parse follows the frames in b, calling count with the message type and size of each frame
+// once its header is complete.
+func (p *frameParser) parse(b []byte, count func(messageType string, size int64)) {
+	for len(b) > 0 {
+		if !p.upgraded {
+			for i, c := range b {
+				switch {
+				case c == headerEnd[p.matched]:
+					p.matched++
+				case c == '\r':
+					p.matched = 1
+				default:
+					p.matched = 0
+				}
+				if p.matched == len(headerEnd) {
+					p.upgraded = true
+					b = b[i+1:]
+					break
+				}
+			}
+			if !p.upgraded {
+				return
+			}
+			continue
+		}
+
+		if p.remaining > 0 {
+			n := int64(len(b))
+			if n > p.remaining {
+				n = p.remaining
+			}
+			p.remaining -= n
+			b = b[n:]
+			continue
+		}
+
+		for len(b) > 0 && len(p.header) < frameHeaderLen(p.header) {
+			p.header = append(p.header, b[0])
+			b = b[1:]
+		}
+		if len(p.header) < frameHeaderLen(p.header) {
+			return
+		}
+		size := framePayloadLen(p.header)
+		count(p.messageType(p.header), int64(len(p.header))+size)
+		p.remaining = size
+		p.header = p.header[:0]
+	}
+}
+
+// messageType returns the message type of a frame, that of the message it continues for
+// continuation frames.
+func (p *frameParser) messageType(header []byte) string {
+	fin := header[0]&0x80 != 0
+	var messageType string
+	switch opcode := header[0] & 0x0f; opcode {
+	case 0:
+		messageType = p.message
+	case 1:
+		messageType = "text"
+	case 2:
+		messageType = "binary"
+	case 8:
+		return "close"
+	case 9:
+		return "ping"
+	case 10:
+		return "pong"
+	default:
+		return fmt.Sprintf("opcode %d", opcode)
+	}
+	if fin {
+		p.message = ""
+	} else {
+		p.message = messageType
+	}
+	return messageType
+}
+
+// frameHeaderLen returns the length of a frame header, as far as known from its first bytes.
+func frameHeaderLen(header []byte) int {
+	if len(header) < 2 {
+		return 2
+	}
+	n := 2
+	switch header[1] & 0x7f {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+	if header[1]&0x80 != 0 {
+		n += 4 // Masking key
+	}
+	return n
+}
+
+// framePayloadLen returns the payload length of a complete frame header.
+func framePayloadLen(header []byte) int64 {
+	switch n := header[1] & 0x7f; n {
+	case 126:
+		return int64(binary.BigEndian.Uint16(header[2:]))
+	case 127:
+		return int64(binary.BigEndian.Uint64(header[2:]))
+	default:
+		return int64(n)
+	}
+}
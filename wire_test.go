@@ -0,0 +1,102 @@
+package wsstat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/relaytools/go-wsstat/internal/wstest"
+)
+
+func TestWireStats(t *testing.T) {
+	server, tlsConfig := wstest.StartTLSEchoServer(t)
+	result, _, err := MeasureLatencyContext(context.Background(), wsURL(t, server, "/echo"), "Hello", http.Header{},
+		WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w := result.Wire
+	// The server sends its certificate chain in the TLS handshake
+	if w.TLS.Written == 0 || w.TLS.Read <= int64(len(server.Certificate().Raw)) {
+		t.Errorf("Unexpected TLS handshake bytes: %+v", w.TLS)
+	}
+	if w.WSUpgrade.Written == 0 || w.WSUpgrade.Read == 0 || w.Messages.Written == 0 || w.Close.Written == 0 {
+		t.Errorf("Expected bytes in every phase: %+v", w)
+	}
+	if w.Proxy != (ByteCount{}) {
+		t.Errorf("Expected no proxy bytes, got %+v", w.Proxy)
+	}
+	// Client frames are masked: 2 header bytes, 4 masking key bytes and the payload
+	if got := w.Sent["text"]; got != (FrameCount{Frames: 1, Bytes: 2 + 4 + 5}) {
+		t.Errorf("Unexpected text frames sent: %+v", got)
+	}
+	if got := w.Received["text"]; got != (FrameCount{Frames: 1, Bytes: 2 + 5}) {
+		t.Errorf("Unexpected text frames received: %+v", got)
+	}
+	if got := w.Sent["close"]; got.Frames != 1 {
+		t.Errorf("Expected a close frame to be sent, got %+v", got)
+	}
+	if out := fmt.Sprintf("%+v", result); !strings.Contains(out, "Frames received: text 1 (7 B)") {
+		t.Errorf("Expected the frames in the output:\n%s", out)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+	if decoded.Wire.TLS != w.TLS || decoded.Wire.Sent["text"] != w.Sent["text"] {
+		t.Errorf("Unexpected decoded wire stats: %+v", decoded.Wire)
+	}
+}
+
+func TestFrameParser(t *testing.T) {
+	var stream bytes.Buffer
+	stream.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n")
+	stream.Write([]byte{0x01, 0x03, 'a', 'b', 'c'}) // Text frame, not final
+	stream.Write([]byte{0x80, 0x7e, 0x01, 0x00})    // Final continuation frame, 256 bytes
+	stream.Write(make([]byte, 256))
+	stream.Write([]byte{0x89, 0x84, 1, 2, 3, 4, 'p', 'i', 'n', 'g'}) // Masked ping frame
+	stream.Write([]byte{0x82, 0x7f, 0, 0, 0, 0, 0, 0, 0x01, 0x00})   // Binary frame, 256 bytes with a 64-bit length
+	stream.Write(make([]byte, 256))
+	data := stream.Bytes()
+
+	// Feed the stream in chunks that split headers and payloads
+	counts := map[string]FrameCount{}
+	var p frameParser
+	for len(data) > 0 {
+		n := 3
+		if n > len(data) {
+			n = len(data)
+		}
+		p.parse(data[:n], func(messageType string, size int64) {
+			fc := counts[messageType]
+			fc.Frames++
+			fc.Bytes += size
+			counts[messageType] = fc
+		})
+		data = data[n:]
+	}
+
+	want := map[string]FrameCount{
+		"text":   {Frames: 2, Bytes: 5 + 4 + 256},
+		"ping":   {Frames: 1, Bytes: 10},
+		"binary": {Frames: 1, Bytes: 10 + 256},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("Unexpected frames: %v", counts)
+	}
+	for messageType, fc := range want {
+		if counts[messageType] != fc {
+			t.Errorf("Expected %s frames %+v, got %+v", messageType, fc, counts[messageType])
+		}
+	}
+}
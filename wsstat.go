@@ -7,6 +7,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -24,12 +25,19 @@ import (
 
 var (
 	// Package-specific logger, defaults to Info level
+	// Used as the default logger of new WSStat instances
 	logger = zerolog.New(os.Stderr).Level(zerolog.InfoLevel).With().Timestamp().Logger()
 
-	// Default dial timeout
+	// Default dial timeout of new WSStat instances
 	dialTimeout = 3 * time.Second
 
-	// Stores optional user-provided TLS configuration
+	// Default timeout for awaiting a response message of new WSStat instances
+	readTimeout = 5 * time.Second
+
+	// A deadline in the past, used to unblock pending reads and writes
+	aLongTimeAgo = time.Unix(1, 0)
+
+	// Stores optional user-provided TLS configuration, the default of new WSStat instances
 	customTLSConfig *tls.Config = nil
 )
 
@@ -49,12 +57,18 @@ type CertificateDetails struct {
 // Result holds durations of each phase of a WebSocket connection, cumulative durations over
 // the connection timeline, and other relevant connection details.
 type Result struct {
-	IPs []string // IP addresses of the WebSocket connection
-	URL url.URL  // URL of the WebSocket connection
+	IPs        []string    // IP addresses the host resolved to (those of the proxy, if one is used)
+	RemoteAddr string      // Address the connection was established to (that of the proxy, if one is used)
+	Transport  string      // Transport of the connection, one of TransportTCP, TransportUnix or TransportCustom
+	FamilyRace *FamilyRace // Outcome of the race between IPv6 and IPv4, if WithHappyEyeballs raced both
+	DNS        *DNSAnswer  // Answer of the resolver, with the TTLs and CNAME chain if it reports them
+	URL        url.URL     // URL of the WebSocket connection
+	Start      time.Time   // Time at which the connection was initiated, the origin of the cumulative durations
 
 	// Duration of each phase of the connection
 	DNSLookup        time.Duration // Time to resolve DNS
 	TCPConnection    time.Duration // TCP connection establishment time
+	ProxyConnect     time.Duration // Time to open the tunnel through the proxy, if one is used
 	TLSHandshake     time.Duration // Time to perform TLS handshake
 	WSHandshake      time.Duration // Time to perform WebSocket handshake
 	MessageRoundTrip time.Duration // Time to send message and receive response
@@ -63,25 +77,45 @@ type Result struct {
 	// Cumulative durations over the connection timeline
 	DNSLookupDone        time.Duration // Time to resolve DNS (might be redundant with DNSLookup)
 	TCPConnected         time.Duration // Time until the TCP connection is established
+	ProxyConnected       time.Duration // Time until the tunnel through the proxy is open
 	TLSHandshakeDone     time.Duration // Time until the TLS handshake is completed
 	WSHandshakeDone      time.Duration // Time until the WS handshake is completed
 	FirstMessageResponse time.Duration // Time until the first message is received
 	TotalTime            time.Duration // Total time from opening to closing the connection
 
 	// Other connection details
-	RequestHeaders  http.Header          // Headers of the initial request
-	ResponseHeaders http.Header          // Headers of the response
-	TLSState        *tls.ConnectionState // State of the TLS connection
+	RequestHeaders    http.Header          // Headers of the initial request
+	ResponseHeaders   http.Header          // Headers of the response
+	StatusCode        int                  // HTTP status code of the handshake response
+	Subprotocol       string               // Subprotocol selected by the server, if any
+	Extensions        []Extension          // Extensions negotiated in the handshake, such as permessage-deflate
+	Wire              WireStats            // Bytes on the wire by phase, and WebSocket frames by message type
+	HandshakeTCPInfo  *TCPInfo             // Kernel statistics of the TCP connection after the handshakes, on Linux
+	MessageTCPInfo    *TCPInfo             // Kernel statistics of the TCP connection after the last message round trip, on Linux
+	TLSState          *tls.ConnectionState // State of the TLS connection
+	CertificateReport *CertificateReport   // Verification report of the server certificates
+	ClientAuth        *ClientAuth          // Client certificate exchange of the TLS handshake
+	SkippedMessages   int                  // Messages received while waiting for responses that the matcher did not accept
+	Skipped           []SkippedMessage     // Skipped messages, if captured with WithCaptureSkipped
+	FailedPhase       Phase                // Phase in which the measurement failed, PhaseNone if it did not fail
+	Stats             *LatencyStats        // Round-trip statistics, set when sampling multiple messages
+
+	certificates []CertificateDetails // Certificate details decoded from JSON, see UnmarshalJSON
 }
 
 // WSStat wraps the gorilla/websocket package and includes latency measurements in Result.
 type WSStat struct {
 	conn   *websocket.Conn
 	dialer *websocket.Dialer
+	cfg    *config
+	wire   *wireCounter
 	Result *Result
+
+	pongs chan struct{} // Signals received pongs, set once the read loop is started
 }
 
 // readLoop is a helper function to process received messages.
+// Once started, it owns reading from the connection until the connection is closed.
 func (ws *WSStat) readLoop() {
 	defer ws.conn.Close()
 	for {
@@ -96,46 +130,91 @@ func (ws *WSStat) readLoop() {
 // CloseConn closes the WebSocket connection and measures the time taken to close the connection.
 // Sets result times: ConnectionClose, TotalTime
 func (ws *WSStat) CloseConn() error {
+	return ws.CloseConnContext(context.Background())
+}
+
+// CloseConnContext is like CloseConn but honors the context: the close message is written
+// with the context's deadline, and is abandoned if the context is cancelled.
+// Sets result times: ConnectionClose, TotalTime
+func (ws *WSStat) CloseConnContext(ctx context.Context) error {
+	stop := ws.interruptOnDone(ctx)
+	defer stop()
+
+	ws.wire.end(wireMessages)
 	start := time.Now()
-	err := ws.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	deadline, _ := ctx.Deadline()
+	err := ws.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
 	if err != nil {
-		return err
+		ws.conn.Close()
+		return ws.fail(PhaseClose, contextError(ctx, err))
 	}
 	err = ws.conn.Close()
 	ws.Result.ConnectionClose = time.Since(start)
 	ws.Result.TotalTime = ws.Result.FirstMessageResponse + ws.Result.ConnectionClose
-	return err
+	ws.wire.end(wireClose)
+	ws.Result.Wire = ws.wire.stats()
+	if err != nil {
+		return ws.fail(PhaseClose, err)
+	}
+	return nil
+}
+
+// Abort closes the connection without the close handshake, as after a failed exchange.
+// Unlike CloseConn it sets no result times.
+func (ws *WSStat) Abort() error {
+	return ws.conn.Close()
 }
 
 // Dial establishes a new WebSocket connection using the custom dialer defined in this package.
 // If required, specify custom headers to merge with the default headers.
 // Sets result times: WSHandshake, WSHandshakeDone
 func (ws *WSStat) Dial(url *url.URL, customHeaders http.Header) error {
+	return ws.DialContext(context.Background(), url, customHeaders)
+}
+
+// DialContext is like Dial but honors the context through the DNS lookup, TCP connection,
+// TLS handshake and WebSocket handshake.
+// On failure the returned PhaseError identifies the failing phase, and the times of the
+// phases that completed remain set in the Result.
+// Sets result times: WSHandshake, WSHandshakeDone
+func (ws *WSStat) DialContext(ctx context.Context, url *url.URL, customHeaders http.Header) error {
 	ws.Result.URL = *url
 	start := time.Now()
-	headers := http.Header{}
-	headers.Add("Origin", "http://example.com") // Add as default header, required by some servers
+	ws.Result.Start = start
+	headers := ws.cfg.headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
 	for name, values := range customHeaders {
 		headers[name] = values
 	}
-	conn, resp, err := ws.dialer.Dial(url.String(), headers)
-	if err != nil {
-		return err
-	}
+	conn, resp, err := ws.dialer.DialContext(ctx, url.String(), headers)
 	totalDialDuration := time.Since(start)
-	ws.conn = conn
-	ws.Result.WSHandshake = totalDialDuration - ws.Result.TLSHandshakeDone
-	ws.Result.WSHandshakeDone = totalDialDuration
-
-	// Lookup IP
-	ips, err := net.LookupIP(url.Hostname())
+	ws.wire.end(wireUpgrade)
+	// Built once the dial is timed, as verifying the chain can take tens of milliseconds
+	ws.Result.CertificateReport = ws.certificateReport(url)
 	if err != nil {
-		return fmt.Errorf("failed to lookup IP: %v", err)
+		if resp != nil {
+			// The server refused the upgrade, keep its response for inspection
+			ws.Result.ResponseHeaders = resp.Header
+			ws.Result.StatusCode = resp.StatusCode
+		}
+		if ErrorPhase(err) == PhaseNone {
+			err = contextError(ctx, err)
+		}
+		return ws.fail(PhaseWSUpgrade, err)
 	}
-	ws.Result.IPs = make([]string, len(ips))
-	for i, ip := range ips {
-		ws.Result.IPs[i] = ip.String()
+	ws.Result.Subprotocol = conn.Subprotocol()
+	ws.Result.Extensions = parseExtensions(resp.Header)
+	if err := checkSubprotocol(ws.cfg.subprotocols, ws.Result.Subprotocol); err != nil {
+		conn.Close()
+		ws.Result.ResponseHeaders = resp.Header
+		ws.Result.StatusCode = resp.StatusCode
+		return ws.fail(PhaseWSUpgrade, err)
 	}
+	ws.conn = conn
+	ws.Result.WSHandshake = totalDialDuration - ws.Result.connected()
+	ws.Result.WSHandshakeDone = totalDialDuration
 
 	// Capture request and response headers
 	// documentedDefaultHeaders lists the known headers that Gorilla WebSocket sets by default.
@@ -144,7 +223,13 @@ func (ws *WSStat) Dial(url *url.URL, customHeaders http.Header) error {
 		"Connection": {"Upgrade"},       // Constant value
 		"Sec-WebSocket-Key": {"<hidden>"},       // A nonce value; dynamically generated for each request
 		"Sec-WebSocket-Version": {"13"}, // Constant value
-		// "Sec-WebSocket-Protocol",     // Also set by gorilla/websocket, but only if subprotocols are specified
+	}
+	// Also set by gorilla/websocket, but only if subprotocols or compression are offered
+	if len(ws.cfg.subprotocols) > 0 {
+		documentedDefaultHeaders["Sec-WebSocket-Protocol"] = []string{strings.Join(ws.cfg.subprotocols, ", ")}
+	}
+	if ws.cfg.compression {
+		documentedDefaultHeaders["Sec-WebSocket-Extensions"] = []string{"permessage-deflate; server_no_context_takeover; client_no_context_takeover"}
 	}
 	// Merge custom headers
     for name, values := range documentedDefaultHeaders {
@@ -152,6 +237,9 @@ func (ws *WSStat) Dial(url *url.URL, customHeaders http.Header) error {
     }
 	ws.Result.RequestHeaders = headers
 	ws.Result.ResponseHeaders = resp.Header
+	ws.Result.StatusCode = resp.StatusCode
+	ws.Result.Wire = ws.wire.stats()
+	ws.Result.HandshakeTCPInfo = ws.snapshotTCPInfo()
 
 	return nil
 }
@@ -161,13 +249,32 @@ func (ws *WSStat) Dial(url *url.URL, customHeaders http.Header) error {
 // Sets result times: MessageRoundTrip, FirstMessageResponse
 // Requires that a timer has been started with WriteMessage to measure the round-trip time.
 func (ws *WSStat) ReadMessage(writeStart time.Time) (int, []byte, error) {
-	ws.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
-	msgType, p, err := ws.conn.ReadMessage()
+	return ws.ReadMessageContext(context.Background(), writeStart)
+}
+
+// ReadMessageContext is like ReadMessage but stops waiting for the message when the context is done.
+// With a matcher set by WithMatcher, it reads until the matcher accepts a message.
+// Sets result times: MessageRoundTrip, FirstMessageResponse
+func (ws *WSStat) ReadMessageContext(ctx context.Context, writeStart time.Time) (int, []byte, error) {
+	return ws.ReadMessageTimeout(ctx, writeStart, ws.cfg.readTimeout)
+}
+
+// ReadMessageTimeout is like ReadMessageContext but waits up to timeout for the message instead of
+// the read timeout, for a message that can take longer than a response, such as a notification.
+// Sets result times: MessageRoundTrip, FirstMessageResponse
+func (ws *WSStat) ReadMessageTimeout(ctx context.Context, writeStart time.Time, timeout time.Duration) (int, []byte, error) {
+	stop := ws.interruptOnDone(ctx)
+	defer stop()
+
+	ws.conn.SetReadDeadline(readDeadline(ctx, timeout))
+	msgType, p, err := ws.readResponse(writeStart)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, ws.fail(PhaseRead, contextError(ctx, err))
 	}
 	ws.Result.MessageRoundTrip = time.Since(writeStart)
 	ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + ws.Result.MessageRoundTrip
+	ws.Result.Wire = ws.wire.stats()
+	ws.Result.MessageTCPInfo = ws.snapshotTCPInfo()
 	return msgType, p, nil
 }
 
@@ -175,10 +282,20 @@ func (ws *WSStat) ReadMessage(writeStart time.Time) (int, []byte, error) {
 // starts a timer to measure the round-trip time.
 // Wraps the gorilla/websocket WriteMessage method.
 func (ws *WSStat) WriteMessage(messageType int, data []byte) (time.Time, error) {
+	return ws.WriteMessageContext(context.Background(), messageType, data)
+}
+
+// WriteMessageContext is like WriteMessage but abandons the write when the context is done.
+func (ws *WSStat) WriteMessageContext(ctx context.Context, messageType int, data []byte) (time.Time, error) {
+	stop := ws.interruptOnDone(ctx)
+	defer stop()
+
+	deadline, _ := ctx.Deadline()
+	ws.conn.SetWriteDeadline(deadline)
 	start := time.Now()
 	err := ws.conn.WriteMessage(messageType, data)
 	if err != nil {
-		return time.Time{}, err
+		return time.Time{}, ws.fail(PhaseWrite, contextError(ctx, err))
 	}
 	return start, err
 }
@@ -187,19 +304,21 @@ func (ws *WSStat) WriteMessage(messageType int, data []byte) (time.Time, error)
 // Wraps the gorilla/websocket WriteMessage and ReadMessage methods.
 // Sets result times: MessageRoundTrip, FirstMessageResponse
 func (ws *WSStat) SendMessage(messageType int, data []byte) ([]byte, error) {
-	start := time.Now()
-	if err := ws.conn.WriteMessage(messageType, data); err != nil {
+	return ws.SendMessageContext(context.Background(), messageType, data)
+}
+
+// SendMessageContext is like SendMessage but honors the context for both the write and the read.
+// Sets result times: MessageRoundTrip, FirstMessageResponse
+func (ws *WSStat) SendMessageContext(ctx context.Context, messageType int, data []byte) ([]byte, error) {
+	start, err := ws.WriteMessageContext(ctx, messageType, data)
+	if err != nil {
 		return nil, err
 	}
-	// Assuming immediate response
-	ws.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
-	_, p, err := ws.conn.ReadMessage()
+	_, p, err := ws.ReadMessageContext(ctx, start)
 	if err != nil {
 		return nil, err
 	}
-	logger.Debug().Bytes("Response", p).Msg("Received message")
-	ws.Result.MessageRoundTrip = time.Since(start)
-	ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + ws.Result.MessageRoundTrip
+	ws.cfg.logger.Debug().Bytes("Response", p).Msg("Received message")
 	return p, nil
 }
 
@@ -218,20 +337,35 @@ func (ws *WSStat) SendMessageBasic() error {
 // Wraps the gorilla/websocket WriteJSON and ReadJSON methods.
 // Sets result times: MessageRoundTrip, FirstMessageResponse
 func (ws *WSStat) SendMessageJSON(v interface{}) (interface{}, error) {
+	return ws.SendMessageJSONContext(context.Background(), v)
+}
+
+// SendMessageJSONContext is like SendMessageJSON but honors the context for both the write and the read.
+// Sets result times: MessageRoundTrip, FirstMessageResponse
+func (ws *WSStat) SendMessageJSONContext(ctx context.Context, v interface{}) (interface{}, error) {
+	stop := ws.interruptOnDone(ctx)
+	defer stop()
+
+	deadline, _ := ctx.Deadline()
+	ws.conn.SetWriteDeadline(deadline)
 	start := time.Now()
 	if err := ws.conn.WriteJSON(&v); err != nil {
-		return nil, err
+		return nil, ws.fail(PhaseWrite, contextError(ctx, err))
 	}
-	// Assuming immediate response
-	ws.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
-	var resp interface{}
-	err := ws.conn.ReadJSON(&resp)
+	ws.conn.SetReadDeadline(readDeadline(ctx, ws.cfg.readTimeout))
+	_, p, err := ws.readResponse(start)
 	if err != nil {
-		return nil, err
+		return nil, ws.fail(PhaseRead, contextError(ctx, err))
 	}
-	logger.Debug().Interface("Response", resp).Msg("Received message")
+	var resp interface{}
+	if err := json.Unmarshal(p, &resp); err != nil {
+		return nil, ws.fail(PhaseRead, err)
+	}
+	ws.cfg.logger.Debug().Interface("Response", resp).Msg("Received message")
 	ws.Result.MessageRoundTrip = time.Since(start)
 	ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + ws.Result.MessageRoundTrip
+	ws.Result.Wire = ws.wire.stats()
+	ws.Result.MessageTCPInfo = ws.snapshotTCPInfo()
 	return resp, nil
 }
 
@@ -239,56 +373,159 @@ func (ws *WSStat) SendMessageJSON(v interface{}) (interface{}, error) {
 // Wraps the gorilla/websocket SetPongHandler and WriteMessage methods.
 // Sets result times: MessageRoundTrip, FirstMessageResponse
 func (ws *WSStat) SendPing() error {
-	pongReceived := make(chan bool) // Unbuffered channel
-	timeout := time.After(5 * time.Second) // Timeout for the pong response
+	return ws.SendPingContext(context.Background())
+}
 
-	ws.conn.SetPongHandler(func(appData string) error {
-		pongReceived <- true
-		return nil
-	})
+// SendPingContext is like SendPing but stops waiting for the pong response when the context is done.
+// Sets result times: MessageRoundTrip, FirstMessageResponse
+func (ws *WSStat) SendPingContext(ctx context.Context) error {
+	timeout := time.NewTimer(ws.cfg.readTimeout) // Timeout for the pong response
+	defer timeout.Stop()
 
-	go ws.readLoop() // Start the read loop to process the pong message
+	if ws.pongs == nil {
+		ws.pongs = make(chan struct{}, 1) // Buffered so the handler never blocks after a timeout
+		ws.conn.SetPongHandler(func(appData string) error {
+			select {
+			case ws.pongs <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+		go ws.readLoop() // Start the read loop to process the pong messages
+	}
+	// Discard a late pong to an earlier ping
+	select {
+	case <-ws.pongs:
+	default:
+	}
 
+	deadline, _ := ctx.Deadline()
 	start := time.Now()
-	if err := ws.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-		return err
+	if err := ws.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+		return ws.fail(PhaseWrite, contextError(ctx, err))
 	}
 
 	select {
-	case <-pongReceived:
+	case <-ws.pongs:
 		ws.Result.MessageRoundTrip = time.Since(start)
-	case <-timeout:
-		return errors.New("pong response timeout")
+	case <-timeout.C:
+		return ws.fail(PhaseRead, errors.New("pong response timeout"))
+	case <-ctx.Done():
+		return ws.fail(PhaseRead, ctx.Err())
 	}
 
 	ws.Result.FirstMessageResponse = ws.Result.WSHandshakeDone + ws.Result.MessageRoundTrip
+	ws.Result.Wire = ws.wire.stats()
+	ws.Result.MessageTCPInfo = ws.snapshotTCPInfo()
 	return nil
 }
 
-// durations returns a map of the time.Duration members of Result.
-func (r *Result) durations() map[string]time.Duration {
-	return map[string]time.Duration{
-		"DNSLookup":        r.DNSLookup,
-		"TCPConnection":    r.TCPConnection,
-		"TLSHandshake":     r.TLSHandshake,
-		"WSHandshake":      r.WSHandshake,
-		"MessageRoundTrip": r.MessageRoundTrip,
-		"ConnectionClose":  r.ConnectionClose,
+// interruptOnDone unblocks any pending read or write on the connection once the context is done.
+// The returned function stops the watch and must be called when the operation completes.
+func (ws *WSStat) interruptOnDone(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, func() {
+		netConn := ws.conn.NetConn()
+		netConn.SetReadDeadline(aLongTimeAgo)
+		netConn.SetWriteDeadline(aLongTimeAgo)
+	})
+}
+
+// ReadTimeout returns how long a read waits for a response, as set with WithReadTimeout.
+// Exchanges of several messages can use it to bound the whole exchange instead of each read.
+func (ws *WSStat) ReadTimeout() time.Duration {
+	return ws.cfg.readTimeout
+}
 
-		"DNSLookupDone":		r.DNSLookupDone,
-		"TCPConnected":			r.TCPConnected,
-		"TLSHandshakeDone":		r.TLSHandshakeDone,
-		"WSHandshakeDone":		r.WSHandshakeDone,
-		"FirstMessageResponse":	r.FirstMessageResponse,
-		"TotalTime":			r.TotalTime,
+// readDeadline returns the deadline for reading a response: timeout from now,
+// or the context's deadline if that is earlier.
+func readDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// contextError returns the context's error if the context is done, otherwise err.
+// Used to report cancellation instead of the i/o timeout it causes on the connection.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// A connection deadline taken from the context can expire just before the context does
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// resultDuration is a time.Duration member of Result, with its field name, JSON key
+// and the phase it measures.
+type resultDuration struct {
+	name  string
+	key   string
+	phase Phase
+	value *time.Duration
+}
+
+// durations returns the time.Duration members of Result, in a stable order.
+func (r *Result) durations() []resultDuration {
+	return []resultDuration{
+		{"DNSLookup", "dns_lookup", PhaseDNS, &r.DNSLookup},
+		{"TCPConnection", "tcp_connection", PhaseTCP, &r.TCPConnection},
+		{"ProxyConnect", "proxy_connect", PhaseProxy, &r.ProxyConnect},
+		{"TLSHandshake", "tls_handshake", PhaseTLS, &r.TLSHandshake},
+		{"WSHandshake", "ws_handshake", PhaseWSUpgrade, &r.WSHandshake},
+		{"MessageRoundTrip", "message_round_trip", PhaseRead, &r.MessageRoundTrip},
+		{"ConnectionClose", "connection_close", PhaseClose, &r.ConnectionClose},
+
+		{"DNSLookupDone", "dns_lookup_done", PhaseDNS, &r.DNSLookupDone},
+		{"TCPConnected", "tcp_connected", PhaseTCP, &r.TCPConnected},
+		{"ProxyConnected", "proxy_connected", PhaseProxy, &r.ProxyConnected},
+		{"TLSHandshakeDone", "tls_handshake_done", PhaseTLS, &r.TLSHandshakeDone},
+		{"WSHandshakeDone", "ws_handshake_done", PhaseWSUpgrade, &r.WSHandshakeDone},
+		{"FirstMessageResponse", "first_message_response", PhaseRead, &r.FirstMessageResponse},
+		{"TotalTime", "total_time", PhaseNone, &r.TotalTime},
+	}
+}
+
+// Applicable reports whether a phase applies to the transport of the connection.
+// The DNS lookup and TCP connection do not apply to Unix sockets and custom dial functions,
+// see WithUnixSocket and WithDialFunc, except that a failure to open their connection is
+// attributed to the TCP connection phase, as the connect phase.
+func (r *Result) Applicable(phase Phase) bool {
+	switch phase {
+	case PhaseDNS:
+		return r.Transport == "" || r.Transport == TransportTCP
+	case PhaseTCP:
+		return r.Transport == "" || r.Transport == TransportTCP || r.FailedPhase == PhaseTCP
+	default:
+		return true
+	}
+}
+
+// connected returns the time until the connection to the server was established,
+// through the proxy and TLS handshake if any.
+func (r *Result) connected() time.Duration {
+	switch {
+	case r.TLSHandshakeDone > 0:
+		return r.TLSHandshakeDone
+	case r.ProxyConnected > 0:
+		return r.ProxyConnected
+	default:
+		return r.TCPConnected
 	}
 }
 
 // CertificateDetails returns a slice of CertificateDetails for each certificate in the TLS connection.
+// For a Result decoded from JSON, returns the certificate details it was encoded with.
 func (r *Result) CertificateDetails() []CertificateDetails {
     if r.TLSState == nil {
         return nil
     }
+	if len(r.TLSState.PeerCertificates) == 0 && r.certificates != nil {
+		return r.certificates
+	}
     var details []CertificateDetails
     for _, cert := range r.TLSState.PeerCertificates {
         details = append(details, CertificateDetails{
@@ -323,14 +560,37 @@ func (r Result) Format(s fmt.State, verb rune) {
 			}
 			fmt.Fprintln(s, "IP")
 			fmt.Fprintf(s, "  %v\n", r.IPs)
+			if r.RemoteAddr != "" {
+				fmt.Fprintf(s, "  Connected to: %s\n", r.RemoteAddr)
+			}
+			if r.DNS != nil {
+				fmt.Fprintf(s, "  Resolver: %s\n", r.DNS.Resolver)
+				if len(r.DNS.CNAMEs) > 0 {
+					fmt.Fprintf(s, "  CNAME chain: %s\n", strings.Join(r.DNS.CNAMEs, " -> "))
+				}
+				for _, a := range r.DNS.Addrs {
+					if a.TTL > 0 {
+						fmt.Fprintf(s, "  TTL %s: %v\n", a.IP, a.TTL)
+					}
+				}
+			}
+			if race := r.FamilyRace; race != nil {
+				fmt.Fprintf(s, "  Happy Eyeballs: %s won, %s lost after %dms: %v\n",
+					race.Winner, race.Loser, race.LoserDuration.Milliseconds(), race.LoserErr)
+			}
 			fmt.Fprintln(s)
 
+			if r.FailedPhase != PhaseNone {
+				fmt.Fprintf(s, "Failed phase: %s\n\n", r.FailedPhase)
+			}
+
 			if r.TLSState != nil {
 				fmt.Fprintf(s, "TLS handshake details\n")
 				fmt.Fprintf(s, "  Version: %s\n", tls.VersionName(r.TLSState.Version))
 				fmt.Fprintf(s, "  Cipher Suite: %s\n", tls.CipherSuiteName(r.TLSState.CipherSuite))
 				fmt.Fprintf(s, "  Server Name: %s\n", r.TLSState.ServerName)
 				fmt.Fprintf(s, "  Handshake Complete: %t\n", r.TLSState.HandshakeComplete)
+				fmt.Fprintf(s, "  Resumed: %t\n", r.TLSState.DidResume)
 
 				for i, cert := range r.CertificateDetails() {
 					fmt.Fprintf(s, "Certificate %d\n", i+1)
@@ -347,6 +607,93 @@ func (r Result) Format(s fmt.State, verb rune) {
 				fmt.Fprintln(s)
 			}
 
+			if cr := r.CertificateReport; cr != nil {
+				fmt.Fprintf(s, "Certificate verification\n")
+				if cr.Verified {
+					fmt.Fprintf(s, "  Verified: true (%s roots)\n", cr.Roots)
+					for i, subject := range cr.Chain {
+						fmt.Fprintf(s, "  Chain %d: %s\n", i, subject)
+					}
+				} else {
+					fmt.Fprintf(s, "  Verified: false (%s roots): %s\n", cr.Roots, cr.VerifyError)
+				}
+				fmt.Fprintf(s, "  Hostname match: %t\n", cr.HostnameMatch)
+				fmt.Fprintf(s, "  Earliest expiry: %s (%d days)\n", cr.EarliestExpiry.Format(time.RFC3339), cr.DaysUntilExpiry)
+				fmt.Fprintf(s, "  OCSP staple: %s\n", cr.OCSPStatus)
+				fmt.Fprintf(s, "  SCTs: %d\n", cr.SCTs)
+				for _, w := range cr.Warnings {
+					fmt.Fprintf(s, "  Warning: %s\n", w)
+				}
+				fmt.Fprintln(s)
+			}
+
+			if ca := r.ClientAuth; ca != nil {
+				fmt.Fprintf(s, "Client certificate\n")
+				fmt.Fprintf(s, "  Requested: %t\n", ca.Requested)
+				for _, name := range ca.AcceptableCAs {
+					fmt.Fprintf(s, "  Acceptable CA: %s\n", name)
+				}
+				if ca.Sent {
+					fmt.Fprintf(s, "  Sent: %s\n", ca.Subject)
+				} else {
+					fmt.Fprintf(s, "  Sent: none\n")
+				}
+				fmt.Fprintln(s)
+			}
+
+			if r.Subprotocol != "" || len(r.Extensions) > 0 {
+				fmt.Fprintf(s, "WebSocket negotiation\n")
+				if r.Subprotocol != "" {
+					fmt.Fprintf(s, "  Subprotocol: %s\n", r.Subprotocol)
+				}
+				for _, ext := range r.Extensions {
+					fmt.Fprintf(s, "  Extension: %s\n", ext)
+				}
+				fmt.Fprintln(s)
+			}
+
+			if w := r.Wire; w.WSUpgrade.Written > 0 {
+				fmt.Fprintf(s, "Bytes on the wire (written/read)\n")
+				if r.ProxyConnected > 0 {
+					fmt.Fprintf(s, "  Proxy connect: %d/%d\n", w.Proxy.Written, w.Proxy.Read)
+				}
+				if r.TLSState != nil {
+					fmt.Fprintf(s, "  TLS handshake: %d/%d\n", w.TLS.Written, w.TLS.Read)
+				}
+				fmt.Fprintf(s, "  WS upgrade: %d/%d\n", w.WSUpgrade.Written, w.WSUpgrade.Read)
+				fmt.Fprintf(s, "  Messages: %d/%d\n", w.Messages.Written, w.Messages.Read)
+				fmt.Fprintf(s, "  Close: %d/%d\n", w.Close.Written, w.Close.Read)
+				fmt.Fprintf(s, "  Frames sent: %s\n", formatFrames(w.Sent))
+				fmt.Fprintf(s, "  Frames received: %s\n", formatFrames(w.Received))
+				fmt.Fprintln(s)
+			}
+
+			if r.HandshakeTCPInfo != nil || r.MessageTCPInfo != nil {
+				fmt.Fprintf(s, "TCP info\n")
+				for _, snapshot := range []struct {
+					name string
+					info *TCPInfo
+				}{{"After handshake", r.HandshakeTCPInfo}, {"After message", r.MessageTCPInfo}} {
+					if info := snapshot.info; info != nil {
+						fmt.Fprintf(s, "  %s: RTT %v, RTT variance %v, retransmits %d, congestion window %d, MSS %d\n",
+							snapshot.name, info.RTT, info.RTTVar, info.Retransmits, info.SndCwnd, info.SndMSS)
+					}
+				}
+				fmt.Fprintln(s)
+			}
+
+			if r.SkippedMessages > 0 {
+				fmt.Fprintf(s, "Skipped messages: %d\n", r.SkippedMessages)
+				for _, m := range r.Skipped {
+					if m.Type == websocket.TextMessage {
+						fmt.Fprintf(s, "  %s after %dms: %s\n", messageTypeName(m.Type), m.Received.Milliseconds(), m.Data)
+					} else {
+						fmt.Fprintf(s, "  %s after %dms: %d bytes\n", messageTypeName(m.Type), m.Received.Milliseconds(), len(m.Data))
+					}
+				}
+				fmt.Fprintln(s)
+			}
+
 			if r.RequestHeaders != nil {
 				fmt.Fprintf(s, "Request headers\n")
 				for k, v := range r.RequestHeaders {
@@ -362,10 +709,22 @@ func (r Result) Format(s fmt.State, verb rune) {
 			fmt.Fprintln(s)
 
 			var buf bytes.Buffer
-			fmt.Fprintf(&buf, "DNS lookup:     %4d ms\n",
-				int(r.DNSLookup/time.Millisecond))
-			fmt.Fprintf(&buf, "TCP connection: %4d ms\n",
-				int(r.TCPConnection/time.Millisecond))
+			if r.Applicable(PhaseDNS) {
+				fmt.Fprintf(&buf, "DNS lookup:     %4d ms\n",
+					int(r.DNSLookup/time.Millisecond))
+			} else {
+				fmt.Fprintf(&buf, "DNS lookup:     %4s\n", "n/a")
+			}
+			if r.Applicable(PhaseTCP) {
+				fmt.Fprintf(&buf, "TCP connection: %4d ms\n",
+					int(r.TCPConnection/time.Millisecond))
+			} else {
+				fmt.Fprintf(&buf, "TCP connection: %4s\n", "n/a")
+			}
+			if r.ProxyConnected > 0 {
+				fmt.Fprintf(&buf, "Proxy connect:  %4d ms\n",
+					int(r.ProxyConnect/time.Millisecond))
+			}
 			fmt.Fprintf(&buf, "TLS handshake:  %4d ms\n",
 				int(r.TLSHandshake/time.Millisecond))
 			fmt.Fprintf(&buf, "WS handshake:   %4d ms\n",
@@ -380,10 +739,22 @@ func (r Result) Format(s fmt.State, verb rune) {
 				fmt.Fprintf(&buf, "Close time:     %4s ms\n\n", "-")
 			}
 
-			fmt.Fprintf(&buf, "Name lookup done:   %4d ms\n",
-				int(r.DNSLookupDone/time.Millisecond))
-			fmt.Fprintf(&buf, "TCP connected:      %4d ms\n",
-				int(r.TCPConnected/time.Millisecond))
+			if r.Applicable(PhaseDNS) {
+				fmt.Fprintf(&buf, "Name lookup done:   %4d ms\n",
+					int(r.DNSLookupDone/time.Millisecond))
+			} else {
+				fmt.Fprintf(&buf, "Name lookup done:   %4s\n", "n/a")
+			}
+			if r.Applicable(PhaseTCP) {
+				fmt.Fprintf(&buf, "TCP connected:      %4d ms\n",
+					int(r.TCPConnected/time.Millisecond))
+			} else {
+				fmt.Fprintf(&buf, "TCP connected:      %4s\n", "n/a")
+			}
+			if r.ProxyConnected > 0 {
+				fmt.Fprintf(&buf, "Proxy connected:    %4d ms\n",
+					int(r.ProxyConnected/time.Millisecond))
+			}
 			fmt.Fprintf(&buf, "TLS handshake done: %4d ms\n",
 				int(r.TLSHandshakeDone/time.Millisecond))
 			fmt.Fprintf(&buf, "WS handshake done:  %4d ms\n",
@@ -397,6 +768,18 @@ func (r Result) Format(s fmt.State, verb rune) {
 			} else {
 				fmt.Fprintf(&buf, "Total:          %4s ms\n", "-")
 			}
+
+			if r.Stats != nil {
+				fmt.Fprintf(&buf, "\nRound trips (%d samples)\n", len(r.Stats.Samples))
+				fmt.Fprintf(&buf, "  Min:     %4d ms\n", int(r.Stats.Min/time.Millisecond))
+				fmt.Fprintf(&buf, "  Max:     %4d ms\n", int(r.Stats.Max/time.Millisecond))
+				fmt.Fprintf(&buf, "  Mean:    %4d ms\n", int(r.Stats.Mean/time.Millisecond))
+				fmt.Fprintf(&buf, "  Std dev: %4d ms\n", int(r.Stats.StdDev/time.Millisecond))
+				fmt.Fprintf(&buf, "  P50:     %4d ms\n", int(r.Stats.P50/time.Millisecond))
+				fmt.Fprintf(&buf, "  P90:     %4d ms\n", int(r.Stats.P90/time.Millisecond))
+				fmt.Fprintf(&buf, "  P99:     %4d ms\n", int(r.Stats.P99/time.Millisecond))
+				fmt.Fprintf(&buf, "  Jitter:  %4d ms\n", int(r.Stats.Jitter/time.Millisecond))
+			}
 			io.WriteString(s, buf.String())
 			return
 		}
@@ -405,13 +788,17 @@ func (r Result) Format(s fmt.State, verb rune) {
 	case 's', 'q':
 		d := r.durations()
 		list := make([]string, 0, len(d))
-		for k, v := range d {
+		for _, v := range d {
+			if !r.Applicable(v.phase) {
+				list = append(list, fmt.Sprintf("%s: n/a", v.name))
+				continue
+			}
 			// Handle when End function is not called
-			if (k == "ConnectionClose" || k == "TotalTime") && r.ConnectionClose == 0 {
-				list = append(list, fmt.Sprintf("%s: - ms", k))
+			if (v.name == "ConnectionClose" || v.name == "TotalTime") && r.ConnectionClose == 0 {
+				list = append(list, fmt.Sprintf("%s: - ms", v.name))
 				continue
 			}
-			list = append(list, fmt.Sprintf("%s: %d ms", k, v/time.Millisecond))
+			list = append(list, fmt.Sprintf("%s: %d ms", v.name, *v.value/time.Millisecond))
 		}
 		io.WriteString(s, strings.Join(list, ", "))
 	}
@@ -420,59 +807,84 @@ func (r Result) Format(s fmt.State, verb rune) {
 // MeasureLatency establishes a WebSocket connection, sends a message, reads the response,
 // and closes the connection. Returns the Result and the response message.
 // Sets all times in the Result object.
-func MeasureLatency(url *url.URL, msg string, customHeaders http.Header) (Result, []byte, error) {
-	ws := NewWSStat()
-	if err := ws.Dial(url, customHeaders); err != nil {
-		logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
-		return Result{}, nil, err
+func MeasureLatency(url *url.URL, msg string, customHeaders http.Header, opts ...Option) (Result, []byte, error) {
+	return MeasureLatencyContext(context.Background(), url, msg, customHeaders, opts...)
+}
+
+// MeasureLatencyContext is like MeasureLatency but honors the context through every phase
+// of the measurement, from the DNS lookup to the close handshake.
+// On failure the returned Result holds the times of the phases that completed.
+func MeasureLatencyContext(ctx context.Context, url *url.URL, msg string, customHeaders http.Header, opts ...Option) (Result, []byte, error) {
+	ws := NewWSStat(opts...)
+	if err := ws.DialContext(ctx, url, customHeaders); err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
+		return *ws.Result, nil, err
 	}
-	start, err := ws.WriteMessage(websocket.TextMessage, []byte(msg))
+	start, err := ws.WriteMessageContext(ctx, websocket.TextMessage, []byte(msg))
 	if err != nil {
-		logger.Debug().Err(err).Msg("Failed to write message")
-		return Result{}, nil, err
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to write message")
+		ws.conn.Close()
+		return *ws.Result, nil, err
 	}
-	_, p, err := ws.ReadMessage(start)
+	_, p, err := ws.ReadMessageContext(ctx, start)
 	if err != nil {
-		logger.Debug().Err(err).Msg("Failed to read message")
-		return Result{}, nil, err
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to read message")
+		ws.conn.Close()
+		return *ws.Result, nil, err
 	}
-	ws.CloseConn()
+	ws.CloseConnContext(ctx)
 	return *ws.Result, p, nil
 }
 
 // MeasureLatencyJSON establishes a WebSocket connection, sends a JSON message, reads the response,
 // and closes the connection. Returns the Result and the response message.
 // Sets all times in the Result object.
-func MeasureLatencyJSON(url *url.URL, v interface{}, customHeaders http.Header) (Result, interface{}, error) {
-	ws := NewWSStat()
-	if err := ws.Dial(url, customHeaders); err != nil {
-		logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
-		return Result{}, nil, err
+func MeasureLatencyJSON(url *url.URL, v interface{}, customHeaders http.Header, opts ...Option) (Result, interface{}, error) {
+	return MeasureLatencyJSONContext(context.Background(), url, v, customHeaders, opts...)
+}
+
+// MeasureLatencyJSONContext is like MeasureLatencyJSON but honors the context through every phase
+// of the measurement, from the DNS lookup to the close handshake.
+// On failure the returned Result holds the times of the phases that completed.
+func MeasureLatencyJSONContext(ctx context.Context, url *url.URL, v interface{}, customHeaders http.Header, opts ...Option) (Result, interface{}, error) {
+	ws := NewWSStat(opts...)
+	if err := ws.DialContext(ctx, url, customHeaders); err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
+		return *ws.Result, nil, err
 	}
-	p, err := ws.SendMessageJSON(v)
+	p, err := ws.SendMessageJSONContext(ctx, v)
 	if err != nil {
-		logger.Debug().Err(err).Msg("Failed to send message")
-		return Result{}, nil, err
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to send message")
+		ws.conn.Close()
+		return *ws.Result, nil, err
 	}
-	ws.CloseConn()
+	ws.CloseConnContext(ctx)
 	return *ws.Result, p, nil
 }
 
 // MeasureLatencyPing establishes a WebSocket connection, sends a ping message, awaits the pong response,
 // and closes the connection. Returns the Result.
 // Sets all times in the Result object.
-func MeasureLatencyPing(url *url.URL, customHeaders http.Header) (Result, error) {
-	ws := NewWSStat()
-	if err := ws.Dial(url, customHeaders); err != nil {
-		logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
-		return Result{}, err
+func MeasureLatencyPing(url *url.URL, customHeaders http.Header, opts ...Option) (Result, error) {
+	return MeasureLatencyPingContext(context.Background(), url, customHeaders, opts...)
+}
+
+// MeasureLatencyPingContext is like MeasureLatencyPing but honors the context through every phase
+// of the measurement, from the DNS lookup to the close handshake.
+// On failure the returned Result holds the times of the phases that completed.
+func MeasureLatencyPingContext(ctx context.Context, url *url.URL, customHeaders http.Header, opts ...Option) (Result, error) {
+	ws := NewWSStat(opts...)
+	if err := ws.DialContext(ctx, url, customHeaders); err != nil {
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to establish WebSocket connection")
+		return *ws.Result, err
 	}
-	err := ws.SendPing()
+	err := ws.SendPingContext(ctx)
 	if err != nil {
-		logger.Debug().Err(err).Msg("Failed to send ping")
-		return Result{}, err
+		ws.cfg.logger.Debug().Err(err).Msg("Failed to send ping")
+		ws.conn.Close()
+		return *ws.Result, err
 	}
-	ws.CloseConn()
+	ws.CloseConnContext(ctx)
 	return *ws.Result, nil
 }
 
@@ -497,112 +909,186 @@ func Port(u url.URL) string {
 }
 
 // newDialer initializes and returns a websocket.Dialer with customized dial functions to measure the connection phases.
+// The bytes of the connections it dials are counted in wire.
 // Sets result times: DNSLookup, TCPConnection, TLSHandshake, DNSLookupDone, TCPConnected, TLSHandshakeDone
-func newDialer(result *Result) *websocket.Dialer {
-	return &websocket.Dialer{
-		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			// Perform DNS lookup
-			dnsStart := time.Now()
-			host, port, _ := net.SplitHostPort(addr)
-			addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+func newDialer(result *Result, cfg *config, wire *wireCounter) *websocket.Dialer {
+	// dial resolves the host and establishes the TCP connection, through the proxy if one is configured,
+	// or calls the configured dial function.
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if cfg.dialFunc != nil {
+			result.Transport = cfg.transport
+			conn, err := cfg.dialFunc(ctx, network, addr)
 			if err != nil {
-				return nil, err
+				return nil, &PhaseError{Phase: PhaseTCP, Err: contextError(ctx, err)}
+			}
+			if remote := conn.RemoteAddr(); remote != nil {
+				result.RemoteAddr = remote.String()
+			}
+			return wire.wrap(conn), nil
+		}
+		result.Transport = TransportTCP
+
+		dialAddr := addr
+		if cfg.proxy != nil {
+			dialAddr = proxyAddr(cfg.proxy)
+		}
+
+		// Perform DNS lookup
+		dnsStart := time.Now()
+		host, port, _ := net.SplitHostPort(dialAddr)
+		answer, err := cfg.resolve(ctx, host)
+		if err != nil {
+			return nil, &PhaseError{Phase: PhaseDNS, Err: contextError(ctx, err)}
+		}
+		result.DNSLookup = time.Since(dnsStart)
+		result.DNSLookupDone = result.DNSLookup
+		result.DNS = answer
+		addrs := make([]string, len(answer.Addrs))
+		for i, a := range answer.Addrs {
+			addrs[i] = a.IP.String()
+		}
+		result.IPs = addrs
+
+		// Resolve the host for the proxy, if it does not resolve it itself
+		if cfg.proxy != nil {
+			if addr, err = proxyTarget(ctx, cfg, addr); err != nil {
+				return nil, &PhaseError{Phase: PhaseDNS, Err: contextError(ctx, err)}
 			}
 			result.DNSLookup = time.Since(dnsStart)
+			result.DNSLookupDone = result.DNSLookup
+		}
+
+		// Connect to the pinned address instead of the first resolved one, if set
+		pinned := false
+		if cfg.dialIP != nil {
+			_, targetPort, _ := net.SplitHostPort(addr)
+			addr = net.JoinHostPort(cfg.dialIP.String(), targetPort)
+			pinned = cfg.proxy == nil
+		}
 
-			// Measure TCP connection time
-			tcpStart := time.Now()
-			conn, err := net.DialTimeout(network, net.JoinHostPort(addrs[0], port), dialTimeout)
+		// Measure TCP connection time
+		tcpStart := time.Now()
+		dialer := &net.Dialer{Timeout: cfg.dialTimeout}
+		var conn net.Conn
+		switch {
+		case pinned:
+			conn, err = dialer.DialContext(ctx, cfg.network, addr)
+		case cfg.happyEyeballs:
+			conn, result.FamilyRace, err = raceFamilies(ctx, dialer, addrs, port, cfg.fallbackDelay)
+		default:
+			conn, err = dialer.DialContext(ctx, cfg.network, net.JoinHostPort(addrs[0], port))
+		}
+		if err != nil {
+			return nil, &PhaseError{Phase: PhaseTCP, Err: contextError(ctx, err)}
+		}
+		result.RemoteAddr = conn.RemoteAddr().String()
+		result.TCPConnection = time.Since(tcpStart)
+
+		// Record the results
+		result.TCPConnected = result.DNSLookupDone + result.TCPConnection
+		conn = wire.wrap(conn)
+
+		// Measure the time to open the tunnel through the proxy
+		if cfg.proxy != nil {
+			proxyStart := time.Now()
+			conn, err = handshakeProxy(ctx, conn, cfg.proxy, addr)
+			wire.end(wireProxy)
 			if err != nil {
-				return nil, err
+				return nil, &PhaseError{Phase: PhaseProxy, Err: err}
 			}
-			result.TCPConnection = time.Since(tcpStart)
-
-			// Record the results
-			result.DNSLookupDone = result.DNSLookup
-			result.TCPConnected = result.DNSLookupDone + result.TCPConnection
+			result.ProxyConnect = time.Since(proxyStart)
+			result.ProxyConnected = result.TCPConnected + result.ProxyConnect
+		}
 
-			return conn, nil
-		},
+		return conn, nil
+	}
 
-		NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			// Perform DNS lookup
-			dnsStart := time.Now()
-			host, port, _ := net.SplitHostPort(addr)
-			addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	return &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
 			if err != nil {
 				return nil, err
 			}
-			result.DNSLookup = time.Since(dnsStart)
+			return wire.parseFrames(conn), nil
+		},
 
-			// Measure TCP connection time
-			tcpStart := time.Now()
-			dialer := &net.Dialer{}
-			netConn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0], port))
+		NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			netConn, err := dial(ctx, network, addr)
 			if err != nil {
 				return nil, err
 			}
-			result.TCPConnection = time.Since(tcpStart)
-
 			// Set up TLS configuration
-			tlsConfig := customTLSConfig
-			if tlsConfig == nil {
-				// Fall back to a default configuration
-				// Note: the default is an insecure configuration, use with caution
-				//tlsConfig = &tls.Config{InsecureSkipVerify: true}
-				tlsConfig = &tls.Config{ServerName: host}
+			host, _, _ := net.SplitHostPort(addr)
+			tlsConfig := cfg.clientTLSConfig()
+			if tlsConfig.ServerName == "" {
+				tlsConfig.ServerName = host
 			}
+			clientAuth := &ClientAuth{}
+			tlsConfig.GetClientCertificate = clientCertificateHook(tlsConfig, clientAuth)
 			tlsStart := time.Now()
 			// Initiate TLS handshake over the established TCP connection
 			tlsConn := tls.Client(netConn, tlsConfig)
-			err = tlsConn.Handshake()
+			err = tlsConn.HandshakeContext(ctx)
+			wire.end(wireTLS)
+			// Reported on failure too, as a rejected client certificate may fail the handshake
+			result.ClientAuth = clientAuth
 			if err != nil {
 				netConn.Close()
-				return nil, err
+				return nil, &PhaseError{Phase: PhaseTLS, Err: contextError(ctx, err)}
 			}
 			result.TLSHandshake = time.Since(tlsStart)
 			state := tlsConn.ConnectionState()
 			result.TLSState = &state
 
 			// Record the results
-			result.DNSLookupDone = result.DNSLookup
-			result.TCPConnected = result.DNSLookupDone + result.TCPConnection
-			result.TLSHandshakeDone = result.TCPConnected + result.TLSHandshake
+			result.TLSHandshakeDone = result.connected() + result.TLSHandshake
 
-			return tlsConn, nil
+			return wire.parseFrames(tlsConn), nil
 		},
+
+		Subprotocols:      cfg.subprotocols,
+		EnableCompression: cfg.compression,
 	}
 }
 
 // NewWSStat creates and returns a new WSStat instance.
-func NewWSStat() *WSStat {
-    result := &Result{}
-	dialer := newDialer(result)
+// Options override the package defaults for this instance only.
+func NewWSStat(opts ...Option) *WSStat {
+	result := &Result{}
+	cfg := newConfig(opts...)
+	wire := &wireCounter{}
+	dialer := newDialer(result, cfg, wire)
 
-    ws := &WSStat{
-        dialer: dialer,
+	ws := &WSStat{
+		dialer: dialer,
+		cfg:    cfg,
+		wire:   wire,
 		Result: result,
-    }
-    return ws
+	}
+	return ws
 }
 
 // SetCustomTLSConfig allows users to provide their own TLS configuration.
 // Pass nil to use default settings.
+// Only affects instances created afterwards, see WithTLSConfig for per-instance configuration.
 func SetCustomTLSConfig(config *tls.Config) {
     customTLSConfig = config
 }
 
 // SetDialTimeout sets the dial timeout for WSStat.
+// Only affects instances created afterwards, see WithDialTimeout for per-instance configuration.
 func SetDialTimeout(timeout time.Duration) {
 	dialTimeout = timeout
 }
 
 // SetLogLevel sets the log level for WSStat.
+// Only affects instances created afterwards, see WithLogger for per-instance configuration.
 func SetLogLevel(level zerolog.Level) {
 	logger = logger.Level(level)
 }
 
 // SetLogger sets the logger for WSStat.
+// Only affects instances created afterwards, see WithLogger for per-instance configuration.
 func SetLogger(l zerolog.Logger) {
 	logger = l
 }
@@ -2,9 +2,12 @@ package wsstat
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"runtime"
@@ -13,13 +16,14 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/relaytools/go-wsstat/internal/wstest"
 	"github.com/rs/zerolog"
 )
 
 var (	
 	serverAddr = "localhost:8080"
 	echoServerAddrWs *url.URL
-		// TODO: support wss in tests
+	silentServerAddrWs *url.URL
 )
 
 func init() {
@@ -28,6 +32,10 @@ func init() {
 	if err != nil {
 		log.Fatalf("Failed to parse URL: %v", err)
 	}
+	silentServerAddrWs, err = url.Parse("ws://" + serverAddr + "/silent")
+	if err != nil {
+		log.Fatalf("Failed to parse URL: %v", err)
+	}
 
 	// Set log level to debug for the tests
 	SetLogLevel(zerolog.DebugLevel)
@@ -108,6 +116,29 @@ func TestMeasureLatencyPing(t *testing.T) {
 	}
 }
 
+func TestMeasureLatencyContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := MeasureLatencyContext(ctx, echoServerAddrWs, "Hello, world!", http.Header{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestMeasureLatencyPingContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result, err := MeasureLatencyPingContext(ctx, echoServerAddrWs, http.Header{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if result.TotalTime <= 0 {
+		t.Errorf("Invalid total time: %v", result.TotalTime)
+	}
+}
+
 func TestNewWSStat(t *testing.T) {
 	ws := NewWSStat()
 
@@ -128,6 +159,27 @@ func TestDial(t *testing.T) {
 	validateDialResult(ws, echoServerAddrWs, getFunctionName(), t)
 }
 
+func TestDialTLS(t *testing.T) {
+	server, tlsConfig := wstest.StartTLSEchoServer(t)
+	url := wsURL(t, server, "/echo")
+
+	ws := NewWSStat(WithTLSConfig(tlsConfig))
+	err := ws.Dial(url, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	validateDialResult(ws, url, getFunctionName(), t)
+	if ws.Result.TLSState == nil || !ws.Result.TLSState.HandshakeComplete {
+		t.Error("Expected completed TLS handshake")
+	}
+	if len(ws.Result.CertificateDetails()) == 0 {
+		t.Error("Expected certificate details")
+	}
+	if err := ws.CloseConn(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
 func TestWriteReadClose(t *testing.T) {
 	ws := NewWSStat()
 	err := ws.Dial(echoServerAddrWs, http.Header{})
@@ -216,6 +268,63 @@ func TestSendMessageJSON(t *testing.T) {
 	validateCloseResult(ws, getFunctionName(), t)
 }
 
+func TestSendMessageContextDeadline(t *testing.T) {
+	ws := NewWSStat()
+	err := ws.DialContext(context.Background(), silentServerAddrWs, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = ws.SendMessageContext(ctx, websocket.TextMessage, []byte("Hello, world!"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read was not interrupted by the context deadline, took %v", elapsed)
+	}
+}
+
+func TestSendMessageContextCancel(t *testing.T) {
+	ws := NewWSStat()
+	err := ws.DialContext(context.Background(), silentServerAddrWs, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = ws.SendMessageContext(ctx, websocket.TextMessage, []byte("Hello, world!"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestReadMessageTimeout(t *testing.T) {
+	ws := NewWSStat(WithReadTimeout(time.Minute))
+	err := ws.DialContext(context.Background(), silentServerAddrWs, http.Header{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ws.conn.Close()
+
+	start, err := ws.WriteMessage(websocket.TextMessage, []byte("Hello, world!"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err = ws.ReadMessageTimeout(context.Background(), start, 100*time.Millisecond)
+	if ErrorPhase(err) != PhaseRead {
+		t.Errorf("Expected read phase error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read was not bounded by its timeout, took %v", elapsed)
+	}
+}
+
 func TestLoggerFunctionality(t *testing.T) {
 	// Set custom logger with buffer as output
 	var buf bytes.Buffer
@@ -257,15 +366,18 @@ func getFunctionName() string {
     return strings.TrimPrefix(runtime.FuncForPC(pc).Name(), "main.")
 }
 
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true // Allow all origins
+	},
+}
+
 // startEchoServer starts a WebSocket server that echoes back any received messages.
 func startEchoServer(addr string) {
-	var upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins
-		},
-	}
+	http.HandleFunc("/echo", wstest.EchoHandler)
 
-	http.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+	// The silent handler accepts messages but never replies
+	http.HandleFunc("/silent", func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Print("upgrade:", err)
@@ -273,17 +385,7 @@ func startEchoServer(addr string) {
 		}
 		defer conn.Close()
 		for {
-			mt, message, err := conn.ReadMessage()
-			if err != nil {
-				// Only print error if it's not a normal closure
-				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-					log.Println("read:", err)
-				}
-				break
-			}
-			err = conn.WriteMessage(mt, message)
-			if err != nil {
-				log.Println("write:", err)
+			if _, _, err := conn.ReadMessage(); err != nil {
 				break
 			}
 		}
@@ -293,6 +395,16 @@ func startEchoServer(addr string) {
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
 
+// wsURL returns the WebSocket URL of a test server for the given path.
+func wsURL(t *testing.T, server *httptest.Server, path string) *url.URL {
+	u, err := url.Parse(server.URL + path)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	return u
+}
+
 // Validation of WSStat results after Dial has been called
 func validateDialResult(ws *WSStat, url *url.URL, msg string, t *testing.T) {
 	if ws.Result.DNSLookup <= 0 {